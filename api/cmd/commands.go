@@ -0,0 +1,404 @@
+package main
+
+import (
+	"api/internal/repository"
+	"api/pkg/config"
+	"api/pkg/event"
+	"api/pkg/ocpasswd"
+	"api/pkg/utils"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes of subcommands
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command administrative subcommand of the api binary
+type command struct {
+	name    string
+	summary string
+	run     func(c context.Context, args []string) error
+}
+
+var commands = []command{
+	{"create-admin", "create an admin user", createAdmin},
+	{"reset-password", "set the password of an admin or staff and revoke its sessions", resetPassword},
+	{"list-staff", "list admin and staff users", listStaff},
+	{"revoke-tokens", "revoke the sessions of a user or of all users", revokeTokens},
+	{"init-panel", "create the panel config", initPanel},
+	{"sync-ocpasswd", "write every ocserv user of the database to ocpasswd", syncOcpasswd},
+	{"import-ocpasswd", "create the ocserv users of ocpasswd that are missing from the database", importOcpasswd},
+	{"ocpasswd-drift", "report and repair differences of ocpasswd from the database", ocpasswdDrift},
+}
+
+// errUsage invalid arguments of a subcommand, the flag set already printed the details
+var errUsage = errors.New("invalid arguments")
+
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printCommands write the subcommands for the usage of the api binary
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nRun '<command> -h' for the flags of a command.")
+}
+
+// runCommand run subcommand name with args and return the exit code
+func runCommand(c context.Context, name string, args []string) int {
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n", name)
+		printCommands(stderr)
+		return exitUsage
+	}
+	err := cmd.run(c, args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	default:
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags parse args of fs, errors other than help are usage errors
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "unexpected argument %q", fs.Arg(0))
+	}
+	return nil
+}
+
+func usageError(fs *flag.FlagSet, format string, a ...interface{}) error {
+	fmt.Fprintf(stderr, format+"\n", a...)
+	fs.Usage()
+	return errUsage
+}
+
+// readPassword return password, or the first line of stdin when it is empty so it is not
+// visible in the process list
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("password is required")
+	}
+	return line, nil
+}
+
+// checkPassword check password against the password policy of panel settings
+func checkPassword(c context.Context, password string) error {
+	policy, err := repository.NewPanelConfigRepository().PasswordPolicy(c)
+	if err != nil {
+		return err
+	}
+	if errs := utils.NewCustomValidator().ValidatePassword("password", password, policy); errs != nil {
+		if m, ok := errs.(map[string]interface{}); ok {
+			if list, ok := m["error"].([]string); ok {
+				return errors.New(strings.Join(list, ", "))
+			}
+		}
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+func createAdmin(c context.Context, args []string) error {
+	fs := newFlagSet("create-admin")
+	username := fs.String("username", "", "admin username")
+	password := fs.String("password", "", "admin password, read from stdin when empty")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if len(*username) < 2 || len(*username) > 16 {
+		return usageError(fs, "username must be 2 to 16 characters")
+	}
+	passwd, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	if err = checkPassword(c, passwd); err != nil {
+		return err
+	}
+	user, err := repository.NewAdminRepository().CreateSuperUser(c, *username, passwd)
+	if err != nil {
+		return err
+	}
+	// the panel is bootstrapped, so the init secret of /user/admin must not be used anymore
+	if err = os.Remove(config.GetApp().InitSecretFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(stderr, "failed to remove init secret file: %v\n", err)
+	}
+	fmt.Fprintf(stdout, "admin %s created with uid %s\n", user.Username, user.UID)
+	return nil
+}
+
+func resetPassword(c context.Context, args []string) error {
+	fs := newFlagSet("reset-password")
+	username := fs.String("username", "", "admin or staff username")
+	password := fs.String("password", "", "new password, read from stdin when empty")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return usageError(fs, "username is required")
+	}
+	user, err := repository.NewAdminRepository().User(c, *username)
+	if err != nil {
+		return err
+	}
+	passwd, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	if err = checkPassword(c, passwd); err != nil {
+		return err
+	}
+	if err = repository.NewStaffRepository().UpdateStaffPassword(c, user.UID, passwd); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "password of %s changed and its sessions revoked\n", user.Username)
+	return nil
+}
+
+func listStaff(c context.Context, args []string) error {
+	fs := newFlagSet("list-staff")
+	asJSON := fs.Bool("json", false, "print users as json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	users, err := repository.NewAdminRepository().Users(c)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(stdout).Encode(users)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "UID\tUSERNAME\tROLE\tSTATUS\tEXPIRE AT")
+	for _, user := range *users {
+		role, status, expireAt := "staff", "active", "-"
+		if user.IsAdmin {
+			role = "admin"
+		}
+		if user.Disabled {
+			status = "disabled"
+		}
+		if user.ExpireAt != nil {
+			expireAt = user.ExpireAt.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", user.UID, user.Username, role, status, expireAt)
+	}
+	return w.Flush()
+}
+
+func revokeTokens(c context.Context, args []string) error {
+	fs := newFlagSet("revoke-tokens")
+	username := fs.String("username", "", "admin or staff username")
+	all := fs.Bool("all", false, "revoke the sessions of all users")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if (*username == "") == !*all {
+		return usageError(fs, "one of -username or -all is required")
+	}
+	admin := repository.NewAdminRepository()
+	var users []repository.UserSummary
+	if *all {
+		list, err := admin.Users(c)
+		if err != nil {
+			return err
+		}
+		users = *list
+	} else {
+		user, err := admin.User(c, *username)
+		if err != nil {
+			return err
+		}
+		users = append(users, repository.UserSummary{UID: user.UID, Username: user.Username})
+	}
+	sessions := repository.NewSessionRepository()
+	for _, user := range users {
+		if err := sessions.RevokeStaffAll(c, user.UID); err != nil {
+			return fmt.Errorf("user %s: %w", user.Username, err)
+		}
+	}
+	fmt.Fprintf(stdout, "sessions of %d users revoked\n", len(users))
+	return nil
+}
+
+func initPanel(c context.Context, args []string) error {
+	fs := newFlagSet("init-panel")
+	siteKey := fs.String("captcha-site-key", "", "captcha site key")
+	secretKey := fs.String("captcha-secret-key", "", "captcha secret key, captcha is disabled when empty")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	panel := repository.NewPanelConfigRepository()
+	_, err := panel.GetConfig(c)
+	if err == nil {
+		return errors.New("panel is already initialized")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	err = panel.CreateConfig(c, models.PanelConfig{
+		Init:                   true,
+		GoogleCaptchaSiteKey:   *siteKey,
+		GoogleCaptchaSecretKey: *secretKey,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "panel initialized")
+	return nil
+}
+
+func syncOcpasswd(c context.Context, args []string) error {
+	fs := newFlagSet("sync-ocpasswd")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	count, err := repository.NewOcservUserRepository().SyncOcpasswd(c)
+	if err != nil {
+		return fmt.Errorf("%d ocserv users written before: %w", count, err)
+	}
+	fmt.Fprintf(stdout, "%d ocserv users written to ocpasswd\n", count)
+	return nil
+}
+
+func importOcpasswd(c context.Context, args []string) error {
+	fs := newFlagSet("import-ocpasswd")
+	file := fs.String("file", config.GetApp().OcpasswdFile, "ocpasswd file")
+	trafficType := fs.String("traffic-type", models.Free, "traffic type of imported users")
+	trafficSize := fs.Int("traffic-size", 0, "traffic size of imported users in GB")
+	dryRun := fs.Bool("dry-run", false, "only report the users that would be imported")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch *trafficType {
+	case models.Free, models.MonthlyTransmit, models.MonthlyReceive, models.TotallyTransmit, models.TotallyReceive:
+	default:
+		return usageError(fs, "unknown traffic type %s", *trafficType)
+	}
+	if *trafficSize < 0 {
+		return usageError(fs, "traffic size must not be negative")
+	}
+	entries, invalid, err := ocpasswd.Read(*file)
+	if err != nil {
+		return err
+	}
+	groups, err := repository.NewOcservGroupRepository().GroupNames(c)
+	if err != nil {
+		return err
+	}
+	report, err := repository.NewOcservUserRepository().ImportOcpasswd(c, entries, invalid, *groups,
+		&repository.OcpasswdImportOptions{TrafficType: *trafficType, TrafficSize: *trafficSize, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	for _, conflict := range report.Conflicts {
+		fmt.Fprintf(stderr, "line %d %s: %s\n", conflict.Line, conflict.Username, conflict.Reason)
+	}
+	verb := "imported"
+	if *dryRun {
+		verb = "would be imported"
+	}
+	fmt.Fprintf(stdout, "%d ocserv users %s, %d conflicts\n", len(report.Created), verb, len(report.Conflicts))
+	return nil
+}
+
+func ocpasswdDrift(c context.Context, args []string) error {
+	fs := newFlagSet("ocpasswd-drift")
+	file := fs.String("file", config.GetApp().OcpasswdFile, "ocpasswd file")
+	repair := fs.Bool("repair", false, "change ocpasswd to match the database")
+	asJSON := fs.Bool("json", false, "print the report as json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	entries, invalid, err := ocpasswd.Read(*file)
+	if err != nil {
+		return err
+	}
+	report, err := repository.NewOcservUserRepository().OcpasswdDrift(c, entries, invalid, *repair)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(stdout).Encode(report)
+	}
+	for _, line := range report.Invalid {
+		fmt.Fprintf(stderr, "line %d: %s\n", line.Line, line.Reason)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tDRIFT\tDATABASE\tOCPASSWD\tREPAIR")
+	for _, drift := range report.Drifts {
+		status := "-"
+		if drift.Repaired {
+			status = "repaired"
+		} else if drift.Error != "" {
+			status = drift.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", drift.Username, drift.Kind, orDash(drift.Database), orDash(drift.Ocpasswd), status)
+	}
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// commandContext context of subcommands, their events are attributed to the cli
+func commandContext() context.Context {
+	return context.WithValue(context.Background(), "userID", event.CLIUserUID)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRunCommandUsage(t *testing.T) {
+	var out bytes.Buffer
+	stderr = &out
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"unknown", nil, exitUsage},
+		{"create-admin", nil, exitUsage},
+		{"create-admin", []string{"-username", "a"}, exitUsage},
+		{"create-admin", []string{"-h"}, exitOK},
+		{"list-staff", []string{"-unknown"}, exitUsage},
+		{"list-staff", []string{"extra"}, exitUsage},
+		{"revoke-tokens", nil, exitUsage},
+		{"revoke-tokens", []string{"-all", "-username", "admin"}, exitUsage},
+		{"import-ocpasswd", []string{"-traffic-type", "Daily"}, exitUsage},
+		{"import-ocpasswd", []string{"-traffic-size", "-1"}, exitUsage},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		code := runCommand(context.Background(), tt.name, tt.args)
+		assert.Equal(t, tt.code, code, "%s %v", tt.name, tt.args)
+		assert.NotEmpty(t, out.String(), "%s %v", tt.name, tt.args)
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	passwd, err := readPassword("given")
+	assert.NoError(t, err)
+	assert.Equal(t, "given", passwd)
+
+	stdin = strings.NewReader("from-stdin\r\nignored\n")
+	passwd, err = readPassword("")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-stdin", passwd)
+
+	stdin = strings.NewReader("")
+	_, err = readPassword("")
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"api/pkg/config"
 	"api/pkg/event"
 	"api/pkg/routing"
+	"context"
 	"flag"
 	"fmt"
 	"github.com/mmtaee/go-oc-utils/database"
@@ -29,8 +30,18 @@ func main() {
 	flag.BoolVar(&debug, "debug", false, "debug mode")
 	flag.BoolVar(&migrate, "migrate", false, "migrate models to database")
 	flag.BoolVar(&drop, "drop", false, "drop models table from database")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command [command flags]]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		printCommands(flag.CommandLine.Output())
+	}
 	flag.Parse()
 
+	if flag.NArg() > 0 && findCommand(flag.Arg(0)) == nil {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
 	config.Set(debug)
 	dbCfg := config.GetDB()
 	dbConfig := &database.DBConfig{
@@ -41,7 +52,14 @@ func main() {
 		Name:     dbCfg.Name,
 	}
 	database.Connect(dbConfig, debug)
-	if migrate {
+	if flag.NArg() > 0 {
+		event.Set(database.Connection(), 100)
+		code := runCommand(commandContext(), flag.Arg(0), flag.Args()[1:])
+		// the worker is not started, so events of the command are saved before exit
+		event.GetWorker().Drain()
+		database.Close()
+		os.Exit(code)
+	} else if migrate {
 		handlers.Migrate()
 	} else if drop && debug {
 		handlers.Drop()
@@ -67,7 +85,13 @@ func main() {
 			eventWorker.Start(eventWorkerCount)
 		}()
 
+		appCfg := config.GetApp()
+		backgroundCtx, stopBackground := context.WithCancel(context.Background())
+		go handlers.ReconcileOcpasswd(backgroundCtx, appCfg.OcpasswdFile, appCfg.ReconcileInterval, appCfg.ReconcileRepair)
+		go handlers.ProcessOcUserOperations(backgroundCtx)
+
 		defer func() {
+			stopBackground()
 			eventWorker.Stop()
 			routing.Shutdown()
 			database.Close()
@@ -0,0 +1,40 @@
+package entities
+
+import "time"
+
+// OcUserOwner staff user that created or was assigned an ocserv user. Staff that are not admin
+// only see and manage the ocserv users they own.
+type OcUserOwner struct {
+	ID        uint      `json:"-" gorm:"primary_key"`
+	OcUserID  uint      `json:"-" gorm:"uniqueIndex;not null"`
+	UserID    uint      `json:"-" gorm:"index;not null"`
+	CreatedAt time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// StaffQuota limits of the ocserv users a staff user provisions. Nil limits and empty groups
+// are not limited.
+type StaffQuota struct {
+	ID            uint      `json:"-" gorm:"primary_key"`
+	UserID        uint      `json:"-" gorm:"uniqueIndex;not null"`
+	MaxUsers      *int      `json:"max_users"`
+	MaxTraffic    *int      `json:"max_traffic"` // sum of traffic size of ocserv users in GB
+	MaxExpireDays *int      `json:"max_expire_days"`
+	Groups        []string  `json:"groups" gorm:"serializer:json;type:text"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// OcUserOperation change of ocpasswd or occtl for an ocserv user. It is written in the transaction
+// of the database change and applied after commit, and retried until it succeeds or runs out of
+// attempts.
+type OcUserOperation struct {
+	ID        uint       `json:"id" gorm:"primary_key"`
+	Kind      string     `json:"kind" gorm:"type:varchar(16);not null" enums:"create,update,lock,unlock,delete,disconnect"`
+	Username  string     `json:"username" gorm:"type:varchar(32);index;not null"`
+	OcUserUID string     `json:"oc_user_uid" gorm:"type:varchar(32)"`
+	Status    string     `json:"status" gorm:"type:varchar(16);index:idx_oc_user_operation_due;not null" enums:"pending,running,failed,done"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error" gorm:"type:text"`
+	NextRunAt time.Time  `json:"next_run_at" gorm:"index:idx_oc_user_operation_due"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
@@ -0,0 +1,20 @@
+package entities
+
+// PanelSetting panel wide settings that are not part of models.PanelConfig. Columns have no
+// database defaults, gorm would save those instead of zero values. GetSettings of the panel
+// repository fills in defaults while no settings are saved.
+type PanelSetting struct {
+	ID                uint   `json:"-" gorm:"primary_key"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	CaptchaProvider   string `json:"captcha_provider" gorm:"type:varchar(16)"`
+	CaptchaVerifyURL  string `json:"captcha_verify_url" gorm:"type:varchar(255)"`
+	LoginMaxFailures  int    `json:"login_max_failures"`
+	LoginLockout      int    `json:"login_lockout"` // in minutes
+	PasswordMinLength int    `json:"password_min_length"`
+	PasswordUpper     bool   `json:"password_upper"`
+	PasswordLower     bool   `json:"password_lower"`
+	PasswordDigit     bool   `json:"password_digit"`
+	PasswordSymbol    bool   `json:"password_symbol"`
+	PasswordDenylist  string `json:"password_denylist" gorm:"type:text"`
+	PasswordHistory   int    `json:"password_history"` // staff passwords that can not be reused
+}
@@ -0,0 +1,22 @@
+package entities
+
+import "time"
+
+// Role named set of actions assigned to staff users. Built-in roles hold all actions of a
+// permission flag of models.UserPermission and are assigned with the flag.
+type Role struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	Name        string    `json:"name" gorm:"type:varchar(32);uniqueIndex;not null"`
+	Description string    `json:"description" gorm:"type:varchar(255)"`
+	Actions     []string  `json:"actions" gorm:"serializer:json;type:text"`
+	Builtin     bool      `json:"builtin" gorm:"default:false"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// UserRole role assigned to a staff user
+type UserRole struct {
+	ID     uint `json:"-" gorm:"primary_key"`
+	UserID uint `json:"-" gorm:"not null;uniqueIndex:idx_user_role"`
+	RoleID uint `json:"-" gorm:"not null;uniqueIndex:idx_user_role;index"`
+	Role   Role `json:"-"`
+}
@@ -0,0 +1,127 @@
+package entities
+
+import (
+	"github.com/mmtaee/go-oc-utils/models"
+	"time"
+)
+
+// UserProfile profile fields of a staff user that the user updates
+type UserProfile struct {
+	ID          uint      `json:"-" gorm:"primary_key"`
+	UserID      uint      `json:"-" gorm:"uniqueIndex;not null"`
+	DisplayName string    `json:"display_name" gorm:"type:varchar(64)"`
+	Email       string    `json:"email" gorm:"type:varchar(255)"`
+	Language    string    `json:"language" gorm:"type:varchar(16)"`
+	UpdatedAt   time.Time `json:"-" gorm:"autoUpdateTime"`
+}
+
+// UserStatus account state of a staff user. Disabled or expired staff can not login and their
+// tokens and api keys are rejected. Staff without a status are active.
+type UserStatus struct {
+	ID         uint       `json:"-" gorm:"primary_key"`
+	UserID     uint       `json:"-" gorm:"uniqueIndex;not null"`
+	Disabled   bool       `json:"disabled" gorm:"default:false"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	ExpireAt   *time.Time `json:"expire_at"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// UserTwoFactor TOTP secret of a staff user. It is enabled after the first code is confirmed.
+type UserTwoFactor struct {
+	ID          uint       `json:"-" gorm:"primary_key"`
+	UserID      uint       `json:"-" gorm:"uniqueIndex;not null"`
+	Secret      string     `json:"-" gorm:"type:varchar(64);not null"`
+	Enabled     bool       `json:"enabled" gorm:"default:false"`
+	LastStep    int64      `json:"-"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// UserRecoveryCode single use recovery code of a staff user stored as sha256 hash
+type UserRecoveryCode struct {
+	ID     uint   `json:"-" gorm:"primary_key"`
+	UserID uint   `json:"-" gorm:"index;not null"`
+	Code   string `json:"-" gorm:"type:varchar(64);not null"`
+}
+
+// UserPasswordHistory previous password hashes of a staff user to deny reuse
+type UserPasswordHistory struct {
+	ID        uint      `json:"-" gorm:"primary_key"`
+	UserID    uint      `json:"-" gorm:"index;not null"`
+	Password  string    `json:"-" gorm:"type:varchar(255);not null"`
+	Salt      string    `json:"-" gorm:"type:varchar(64)"`
+	CreatedAt time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// UserDirectory link of a staff user provisioned from the LDAP directory.
+// Linked users have no local password and login only through the directory.
+type UserDirectory struct {
+	ID       uint      `json:"-" gorm:"primary_key"`
+	UserID   uint      `json:"-" gorm:"uniqueIndex;not null"`
+	DN       string    `json:"dn" gorm:"type:varchar(255);not null"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// UserIdentity link of a staff user provisioned from an OpenID Connect provider
+type UserIdentity struct {
+	ID       uint      `json:"-" gorm:"primary_key"`
+	UserID   uint      `json:"-" gorm:"index;not null"`
+	Provider string    `json:"provider" gorm:"type:varchar(32);not null;uniqueIndex:idx_user_identity_subject"`
+	Subject  string    `json:"subject" gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identity_subject"`
+	Email    string    `json:"email" gorm:"type:varchar(255)"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// OIDCLogin pending single sign-on login. The PKCE verifier never leaves the server and
+// the state is deleted on the first callback.
+type OIDCLogin struct {
+	ID       uint      `json:"-" gorm:"primary_key"`
+	State    string    `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Provider string    `json:"-" gorm:"type:varchar(32);not null"`
+	Verifier string    `json:"-" gorm:"type:varchar(128);not null"`
+	Nonce    string    `json:"-" gorm:"type:varchar(64);not null"`
+	ExpireAt time.Time `json:"-" gorm:"index"`
+}
+
+// UserSession client details of a login token
+type UserSession struct {
+	ID          uint       `json:"-" gorm:"primary_key"`
+	UserTokenID uint       `json:"-" gorm:"uniqueIndex;not null"`
+	UserID      uint       `json:"-" gorm:"index;not null"`
+	IP          string     `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent   string     `json:"user_agent" gorm:"type:varchar(255)"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+// LoginFailure failed login attempts of a username or a source ip
+type LoginFailure struct {
+	ID            uint       `json:"id" gorm:"primary_key"`
+	Kind          string     `json:"kind" gorm:"type:varchar(16);not null;uniqueIndex:idx_login_failure_subject"`
+	Subject       string     `json:"subject" gorm:"type:varchar(64);not null;uniqueIndex:idx_login_failure_subject"`
+	Failures      int        `json:"failures"`
+	Locked        bool       `json:"locked"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	BlockedUntil  *time.Time `json:"blocked_until"`
+}
+
+// ApiKey long-lived key of a staff user for automation. Only the sha256 hash of the key is stored
+// and its scope is a subset of the owner permissions.
+type ApiKey struct {
+	ID         uint        `json:"id" gorm:"primary_key"`
+	UID        string      `json:"uid" gorm:"type:varchar(16);uniqueIndex;not null"`
+	UserID     uint        `json:"-" gorm:"index;not null"`
+	User       models.User `json:"-"`
+	Name       string      `json:"name" gorm:"type:varchar(64);not null"`
+	Prefix     string      `json:"prefix" gorm:"type:varchar(16);not null"`
+	Hash       string      `json:"-" gorm:"type:varchar(64);uniqueIndex;not null"`
+	OcUser     bool        `json:"oc_user"`
+	OcGroup    bool        `json:"oc_group"`
+	Statistic  bool        `json:"statistic"`
+	Occtl      bool        `json:"occtl"`
+	System     bool        `json:"system"`
+	AllowedIPs string      `json:"-" gorm:"type:text"`
+	ExpireAt   *time.Time  `json:"expire_at"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+	CreatedAt  time.Time   `json:"created_at" gorm:"autoCreateTime"`
+}
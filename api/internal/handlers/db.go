@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"api/internal/entities"
+	"api/internal/repository"
 	"api/pkg/event"
 	"fmt"
 	"github.com/mmtaee/go-oc-utils/database"
@@ -16,7 +18,24 @@ var tables = []interface{}{
 	&models.OcUser{},
 	&models.OcUserActivity{},
 	&models.OcUserTrafficStatistics{},
+	&entities.OcUserOwner{},
+	&entities.OcUserOperation{},
+	&entities.StaffQuota{},
 	&event.Event{},
+	&entities.UserProfile{},
+	&entities.UserStatus{},
+	&entities.UserTwoFactor{},
+	&entities.UserRecoveryCode{},
+	&entities.UserPasswordHistory{},
+	&entities.UserDirectory{},
+	&entities.UserIdentity{},
+	&entities.OIDCLogin{},
+	&entities.UserSession{},
+	&entities.LoginFailure{},
+	&entities.ApiKey{},
+	&entities.Role{},
+	&entities.UserRole{},
+	&entities.PanelSetting{},
 }
 
 func Migrate() {
@@ -25,6 +44,12 @@ func Migrate() {
 	if err != nil {
 		logger.Log(logger.CRITICAL, fmt.Sprintf("error sync tables: %v", err))
 	}
+	if err = repository.MigrateRoles(engine); err != nil {
+		logger.Log(logger.CRITICAL, fmt.Sprintf("error migrating permissions to roles: %v", err))
+	}
+	if err = repository.MigrateOcUserOwners(engine); err != nil {
+		logger.Log(logger.CRITICAL, fmt.Sprintf("error migrating ocserv user owners: %v", err))
+	}
 	logger.Log(logger.INFO, "migrating tables successfully")
 }
 
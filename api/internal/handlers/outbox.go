@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"api/internal/repository"
+	"api/pkg/event"
+	"context"
+	"github.com/mmtaee/go-oc-utils/logger"
+	"time"
+)
+
+const (
+	outboxInterval  = 10 * time.Second
+	outboxBatchSize = 100
+)
+
+// ProcessOcUserOperations apply the due operations of the ocserv user outbox until c is done.
+// Operations of requests are applied right after commit, so this retries the failed ones and
+// the ones left behind by an api that stopped.
+func ProcessOcUserOperations(c context.Context) {
+	c = context.WithValue(c, "userID", event.SystemUserUID)
+	repo := repository.NewOcUserOutboxRepository()
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := repo.Process(c, outboxBatchSize); err != nil {
+				logger.Logf(logger.ERROR, "ocserv user operations failed: %v", err)
+			}
+		case <-c.Done():
+			return
+		}
+	}
+}
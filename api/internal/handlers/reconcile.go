@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"api/internal/repository"
+	"api/pkg/event"
+	"api/pkg/ocpasswd"
+	"context"
+	"github.com/mmtaee/go-oc-utils/logger"
+	"time"
+)
+
+// ReconcileOcpasswd check ocpasswd for drift from the ocserv users every interval until c is
+// done, and repair it when repair is set. Drifts are recorded as ocpasswd_drift events of the
+// system user.
+func ReconcileOcpasswd(c context.Context, path string, interval time.Duration, repair bool) {
+	if interval <= 0 {
+		logger.Log(logger.WARNING, "ocpasswd drift check is disabled")
+		return
+	}
+	c = context.WithValue(c, "userID", event.SystemUserUID)
+	repo := repository.NewOcservUserRepository()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reconcileOcpasswd(c, repo, path, repair)
+		case <-c.Done():
+			return
+		}
+	}
+}
+
+func reconcileOcpasswd(c context.Context, repo *repository.OcservUserRepository, path string, repair bool) {
+	entries, invalid, err := ocpasswd.Read(path)
+	if err != nil {
+		logger.Logf(logger.ERROR, "ocpasswd drift check failed: %v", err)
+		return
+	}
+	report, err := repo.OcpasswdDrift(c, entries, invalid, repair)
+	if err != nil {
+		logger.Logf(logger.ERROR, "ocpasswd drift check failed: %v", err)
+		return
+	}
+	repaired := 0
+	for _, drift := range report.Drifts {
+		if drift.Repaired {
+			repaired++
+		}
+	}
+	if len(report.Drifts) > 0 {
+		logger.Logf(logger.WARNING, "%d drifts of ocpasswd found, %d repaired", len(report.Drifts), repaired)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mmtaee/go-oc-utils/database"
 	"github.com/mmtaee/go-oc-utils/models"
 	"gorm.io/gorm"
+	"time"
 )
 
 type AdminRepository struct {
@@ -14,6 +15,17 @@ type AdminRepository struct {
 
 type AdminRepositoryInterface interface {
 	CreateSuperUser(c context.Context, username, passwd string) (*models.User, error)
+	User(c context.Context, username string) (*models.User, error)
+	Users(c context.Context) (*[]UserSummary, error)
+}
+
+// UserSummary admin or staff user with its account status
+type UserSummary struct {
+	UID      string     `json:"uid"`
+	Username string     `json:"username"`
+	IsAdmin  bool       `json:"is_admin"`
+	Disabled bool       `json:"disabled"`
+	ExpireAt *time.Time `json:"expire_at"`
 }
 
 func NewAdminRepository() *AdminRepository {
@@ -61,3 +73,27 @@ func (a *AdminRepository) CreateSuperUser(c context.Context, username, passwd st
 	}
 	return &user, nil
 }
+
+// User admin or staff user by username
+func (a *AdminRepository) User(c context.Context, username string) (*models.User, error) {
+	var user models.User
+	if err := a.db.WithContext(c).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Users all admin and staff users, admins first
+func (a *AdminRepository) Users(c context.Context) (*[]UserSummary, error) {
+	var users []UserSummary
+	err := a.db.WithContext(c).Table("users").
+		Joins("LEFT JOIN user_statuses ON user_statuses.user_id = users.id").
+		Select("users.uid, users.username, users.is_admin, " +
+			"COALESCE(user_statuses.disabled, false) AS disabled, user_statuses.expire_at").
+		Order("users.is_admin DESC, users.username").
+		Scan(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return &users, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"api/pkg/rbac"
+	"api/pkg/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type ApiKeyRepository struct {
+	db          *gorm.DB
+	WorkerEvent *event.WorkerEvent
+}
+
+type ApiKeyRepositoryInterface interface {
+	Create(c context.Context, userID uint, data *CreateApiKey) (*ApiKeyCreated, error)
+	ApiKeys(c context.Context, userID uint) (*[]entities.ApiKey, error)
+	Revoke(c context.Context, userID, id uint) error
+}
+
+// CreateApiKey name, scope and restrictions of a new api key
+type CreateApiKey struct {
+	Name       string
+	Permission models.UserPermission
+	AllowedIPs []string
+	ExpireAt   *time.Time
+}
+
+// ApiKeyCreated api key with the plain key that is shown only once
+type ApiKeyCreated struct {
+	entities.ApiKey
+	Key string `json:"key"`
+}
+
+func NewApiKeyRepository() *ApiKeyRepository {
+	return &ApiKeyRepository{
+		db:          database.Connection(),
+		WorkerEvent: event.GetWorker(),
+	}
+}
+
+// checkScope return an error when the scope grants an area in which the owner has no action
+func checkScope(owner *models.User, actions []string, scope models.UserPermission) error {
+	if owner.IsAdmin {
+		return nil
+	}
+	granted := make(map[string]bool)
+	for _, action := range actions {
+		granted[rbac.Action(action).Area()] = true
+	}
+	for _, area := range rbac.Areas {
+		if rbac.AreaGranted(scope, area) && !granted[area] {
+			return fmt.Errorf("%s permission is not granted to you", area)
+		}
+	}
+	return nil
+}
+
+func newApiKeyUID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Create create api key of user scoped to a subset of user permissions
+func (a *ApiKeyRepository) Create(c context.Context, userID uint, data *CreateApiKey) (*ApiKeyCreated, error) {
+	if data.ExpireAt != nil && !data.ExpireAt.After(time.Now()) {
+		return nil, errors.New("expire at must be in the future")
+	}
+	var owner models.User
+	if err := a.db.WithContext(c).First(&owner, userID).Error; err != nil {
+		return nil, err
+	}
+	actions, err := UserActions(a.db.WithContext(c), owner.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkScope(&owner, actions, data.Permission); err != nil {
+		return nil, err
+	}
+
+	key, prefix, err := utils.NewApiKey()
+	if err != nil {
+		return nil, err
+	}
+	uid, err := newApiKeyUID()
+	if err != nil {
+		return nil, err
+	}
+	apiKey := entities.ApiKey{
+		UID:        uid,
+		UserID:     owner.ID,
+		Name:       data.Name,
+		Prefix:     prefix,
+		Hash:       utils.HashApiKey(key),
+		OcUser:     data.Permission.OcUser,
+		OcGroup:    data.Permission.OcGroup,
+		Statistic:  data.Permission.Statistic,
+		Occtl:      data.Permission.Occtl,
+		System:     data.Permission.System,
+		AllowedIPs: strings.Join(data.AllowedIPs, ","),
+		ExpireAt:   data.ExpireAt,
+	}
+	if err = a.db.WithContext(c).Omit("User").Create(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	a.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "create_api_key",
+		ModelName: "api_key",
+		ModelUID:  apiKey.UID,
+		UserUID:   actorUID(c),
+		NewState:  apiKey,
+	})
+	return &ApiKeyCreated{ApiKey: apiKey, Key: key}, nil
+}
+
+// ApiKeys list api keys of user
+func (a *ApiKeyRepository) ApiKeys(c context.Context, userID uint) (*[]entities.ApiKey, error) {
+	var apiKeys []entities.ApiKey
+	err := a.db.WithContext(c).Where("user_id = ?", userID).Order("id DESC").Find(&apiKeys).Error
+	if err != nil {
+		return nil, err
+	}
+	return &apiKeys, nil
+}
+
+// Revoke delete api key of user
+func (a *ApiKeyRepository) Revoke(c context.Context, userID, id uint) error {
+	var apiKey entities.ApiKey
+	err := a.db.WithContext(c).Where("id = ? AND user_id = ?", id, userID).First(&apiKey).Error
+	if err != nil {
+		return err
+	}
+	if err = a.db.WithContext(c).Delete(&apiKey).Error; err != nil {
+		return err
+	}
+	a.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "revoke_api_key",
+		ModelName: "api_key",
+		ModelUID:  apiKey.UID,
+		UserUID:   actorUID(c),
+	})
+	return nil
+}
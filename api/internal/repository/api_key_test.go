@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"api/pkg/rbac"
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckScope(t *testing.T) {
+	staff := &models.User{}
+	actions := []string{string(rbac.OcUserRead), string(rbac.StatisticRead)}
+	assert.NoError(t, checkScope(staff, actions, models.UserPermission{OcUser: true}))
+	assert.NoError(t, checkScope(staff, actions, models.UserPermission{}))
+	assert.EqualError(t, checkScope(staff, actions, models.UserPermission{OcUser: true, Occtl: true}), "occtl permission is not granted to you")
+
+	// the old permission flags of the owner do not grant an area anymore
+	flagged := &models.User{Permission: models.UserPermission{Occtl: true}}
+	assert.EqualError(t, checkScope(flagged, nil, models.UserPermission{Occtl: true}), "occtl permission is not granted to you")
+
+	admin := &models.User{IsAdmin: true}
+	assert.NoError(t, checkScope(admin, nil, models.UserPermission{OcUser: true, OcGroup: true, Occtl: true, System: true}))
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/config"
+	"api/pkg/directory"
+	"api/pkg/event"
+	"api/pkg/tokencache"
+	"context"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type DirectoryRepository struct {
+	db          *gorm.DB
+	cfg         *config.LDAP
+	auth        directory.Authenticator
+	WorkerEvent *event.WorkerEvent
+}
+
+type DirectoryRepositoryInterface interface {
+	Enabled() bool
+	Linked(c context.Context, userID uint) (bool, error)
+	Login(c context.Context, username, password string) (*models.User, error)
+}
+
+func NewDirectoryRepository() *DirectoryRepository {
+	cfg := config.GetLDAP()
+	return &DirectoryRepository{
+		db:          database.Connection(),
+		cfg:         cfg,
+		auth:        directory.New(cfg),
+		WorkerEvent: event.GetWorker(),
+	}
+}
+
+// Enabled report whether staff can login with the LDAP directory
+func (d *DirectoryRepository) Enabled() bool {
+	return d.cfg.URL != ""
+}
+
+// Linked report whether user is provisioned from the directory
+func (d *DirectoryRepository) Linked(c context.Context, userID uint) (bool, error) {
+	return isDirectoryUser(d.db.WithContext(c), userID)
+}
+
+func isDirectoryUser(tx *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&entities.UserDirectory{}).Where("user_id = ?", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// Login authenticate user with the directory, then create or update the staff user with
+// admin status and permissions of its directory groups
+func (d *DirectoryRepository) Login(c context.Context, username, password string) (*models.User, error) {
+	entry, err := d.auth.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	isAdmin, permission := d.cfg.Permission(entry.Groups)
+
+	var (
+		user    *models.User
+		created bool
+	)
+	err = d.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var existing models.User
+		err := tx.Where("username = ?", username).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			created = true
+			if user, err = createExternalUser(tx, username, isAdmin, permission); err != nil {
+				return err
+			}
+			return tx.Create(&entities.UserDirectory{UserID: user.ID, DN: entry.DN, SyncedAt: time.Now()}).Error
+		}
+		if err != nil {
+			return err
+		}
+		user = &existing
+
+		linked, err := isDirectoryUser(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if !linked {
+			return errLocalUserExists
+		}
+		if err = syncExternalUser(tx, user, isAdmin, permission); err != nil {
+			return err
+		}
+		return tx.Model(&entities.UserDirectory{}).Where("user_id = ?", user.ID).
+			Updates(map[string]interface{}{"dn": entry.DN, "synced_at": time.Now()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		d.WorkerEvent.AddEvent(&event.SchemaEvent{
+			ModelName: "user",
+			EventType: "create_staff",
+			ModelUID:  user.UID,
+			UserUID:   event.SystemUserUID,
+			NewState:  user,
+		})
+	} else {
+		// permissions of cached tokens must follow the directory groups
+		tokencache.Default().Invalidate(user.ID)
+	}
+	return user, nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"api/internal/entities"
 	"api/pkg/event"
 	"api/pkg/utils"
 	"context"
@@ -53,6 +54,39 @@ func (e *EventRepository) Events(
 	case "delete_staff":
 		oldStateType = nil
 		newStateType = nil
+	case "reset_staff_two_factor", "enable_two_factor", "disable_two_factor":
+		oldStateType = nil
+		newStateType = nil
+	case "update_staff_roles":
+		oldStateType = nil
+		newStateType = &[]string{}
+	case "disable_staff", "enable_staff", "update_staff_expiry":
+		oldStateType = &entities.UserStatus{}
+		newStateType = &entities.UserStatus{}
+	case "update_staff_quota":
+		oldStateType = &entities.StaffQuota{}
+		newStateType = &entities.StaffQuota{}
+	case "create_role", "update_role", "delete_role":
+		oldStateType = &entities.Role{}
+		newStateType = &entities.Role{}
+	case "login_success", "login_failed", "logout", "password_changed":
+		oldStateType = nil
+		newStateType = &AuthEvent{}
+	case "update_profile":
+		oldStateType = &entities.UserProfile{}
+		newStateType = &entities.UserProfile{}
+	case "create_api_key":
+		oldStateType = nil
+		newStateType = &entities.ApiKey{}
+	case "revoke_api_key":
+		oldStateType = nil
+		newStateType = nil
+	case "login_lockout":
+		oldStateType = nil
+		newStateType = &entities.LoginFailure{}
+	case "update_panel_settings":
+		oldStateType = &entities.PanelSetting{}
+		newStateType = &entities.PanelSetting{}
 	case "update_panel_config":
 		oldStateType = &models.PanelConfig{}
 		newStateType = &models.PanelConfig{}
@@ -81,12 +115,27 @@ func (e *EventRepository) Events(
 	case "unlock_oc_user":
 		oldStateType = ""
 		newStateType = ""
+	case "update_oc_user_owner":
+		oldStateType = ""
+		newStateType = ""
 	case "disconnect_oc_user":
 		oldStateType = nil
 		newStateType = nil
 	case "delete_oc_user":
 		oldStateType = nil
 		newStateType = nil
+	case "bulk_oc_users":
+		oldStateType = nil
+		newStateType = &BulkEvent{}
+	case "import_ocpasswd":
+		oldStateType = nil
+		newStateType = &OcpasswdImport{}
+	case "ocpasswd_drift":
+		oldStateType = nil
+		newStateType = &OcpasswdDriftReport{}
+	case "retry_oc_user_operation":
+		oldStateType = nil
+		newStateType = &entities.OcUserOperation{}
 	default:
 		return nil, errors.New("not found")
 	}
@@ -116,3 +165,13 @@ func (e *EventRepository) Events(
 	}
 	return eventList, nil
 }
+
+// actorUID user uid of events from request context. Requests authenticated with an api key are
+// attributed to the key.
+func actorUID(c context.Context) string {
+	if keyUID, ok := c.Value("apiKeyUID").(string); ok && keyUID != "" {
+		return "api_key:" + keyUID
+	}
+	userID, _ := c.Value("userID").(string)
+	return userID
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+)
+
+// externalPassword password hash of users provisioned from the directory or an identity provider.
+// It never matches a password.
+const externalPassword = "!external"
+
+var (
+	errNoPanelGroup    = errors.New("user is not a member of any panel group")
+	errExternalManaged = errors.New("password of this user is managed by the directory or the identity provider")
+	errLocalUserExists = errors.New("a local user with the same username exists")
+)
+
+// isExternalUser report whether user is provisioned from the directory or an identity provider
+func isExternalUser(tx *gorm.DB, userID uint) (bool, error) {
+	for _, model := range []interface{}{&entities.UserDirectory{}, &entities.UserIdentity{}} {
+		var count int64
+		if err := tx.Model(model).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// createExternalUser create a staff user without local password and its permission
+func createExternalUser(tx *gorm.DB, username string, isAdmin bool, permission models.UserPermission) (*models.User, error) {
+	if !isAdmin && permission == (models.UserPermission{}) {
+		return nil, errNoPanelGroup
+	}
+	user := models.User{Username: username, Password: externalPassword, IsAdmin: isAdmin}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	permission.UserID = user.ID
+	if err := tx.Create(&permission).Error; err != nil {
+		return nil, err
+	}
+	if err := syncFlagRoles(tx, user.ID, permission); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// syncExternalUser update admin status, permission and built-in roles of user to its current groups
+func syncExternalUser(tx *gorm.DB, user *models.User, isAdmin bool, permission models.UserPermission) error {
+	if !isAdmin && permission == (models.UserPermission{}) {
+		return errNoPanelGroup
+	}
+	if err := tx.Model(user).Update("is_admin", isAdmin).Error; err != nil {
+		return err
+	}
+	err := tx.Model(&models.UserPermission{}).Where("user_id = ?", user.ID).
+		Select("oc_user", "oc_group", "statistic", "occtl", "system").
+		Updates(&permission).Error
+	if err != nil {
+		return err
+	}
+	return syncFlagRoles(tx, user.ID, permission)
+}
+
+// deleteExternalLinks delete directory and identity provider links of a deleted user
+func deleteExternalLinks(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&entities.UserDirectory{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&entities.UserIdentity{}).Error
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	lockoutKindUsername = "username"
+	lockoutKindIP       = "ip"
+
+	// ipFailureFactor an ip may be shared by many users (NAT), so it has a higher threshold than usernames
+	ipFailureFactor = 4
+	// failureWindow failures older than this are forgotten
+	failureWindow   = 24 * time.Hour
+	maxLoginBackoff = 30 * time.Second
+	maxLoginLockout = 24 * time.Hour
+)
+
+// LoginBlockedError returned when username or ip must wait before next login attempt
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %d seconds", e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds remaining wait time rounded up to seconds
+func (e *LoginBlockedError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+type LockoutRepository struct {
+	db          *gorm.DB
+	panel       PanelConfigRepositoryInterface
+	WorkerEvent *event.WorkerEvent
+}
+
+type LockoutRepositoryInterface interface {
+	Check(c context.Context, username, ip string) error
+	Fail(c context.Context, username, ip string) error
+	Succeed(c context.Context, username string) error
+	Lockouts(c context.Context) (*[]entities.LoginFailure, error)
+	Clear(c context.Context, id uint) error
+	ClearAll(c context.Context) error
+}
+
+func NewLockoutRepository() *LockoutRepository {
+	return &LockoutRepository{
+		db:          database.Connection(),
+		panel:       NewPanelConfigRepository(),
+		WorkerEvent: event.GetWorker(),
+	}
+}
+
+// loginDelay wait time after the given failures. Below maxFailures the delay is an exponential
+// backoff capped to maxLoginBackoff, after it the account is locked for lockout and the lockout
+// is doubled for every further failure up to maxLoginLockout.
+func loginDelay(failures, maxFailures int, lockout time.Duration) (time.Duration, bool) {
+	if failures <= 0 {
+		return 0, false
+	}
+	if failures < maxFailures {
+		delay := time.Second
+		for i := 1; i < failures && delay < maxLoginBackoff; i++ {
+			delay *= 2
+		}
+		return min(delay, maxLoginBackoff), false
+	}
+	delay := lockout
+	for i := maxFailures; i < failures && delay < maxLoginLockout; i++ {
+		delay *= 2
+	}
+	return min(delay, maxLoginLockout), true
+}
+
+func lockoutSubjects(username, ip string) map[string]string {
+	subjects := map[string]string{}
+	if username = strings.ToLower(strings.TrimSpace(username)); username != "" {
+		if len(username) > 64 {
+			username = username[:64]
+		}
+		subjects[lockoutKindUsername] = username
+	}
+	if ip != "" {
+		subjects[lockoutKindIP] = ip
+	}
+	return subjects
+}
+
+// Check return LoginBlockedError when username or ip is in backoff or locked
+func (l *LockoutRepository) Check(c context.Context, username, ip string) error {
+	now := time.Now()
+	var retryAfter time.Duration
+	for kind, subject := range lockoutSubjects(username, ip) {
+		var failure entities.LoginFailure
+		err := l.db.WithContext(c).Where("kind = ? AND subject = ?", kind, subject).First(&failure).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		if failure.BlockedUntil != nil && failure.BlockedUntil.After(now) {
+			retryAfter = max(retryAfter, failure.BlockedUntil.Sub(now))
+		}
+	}
+	if retryAfter > 0 {
+		return &LoginBlockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail record a failed login attempt of username and ip
+func (l *LockoutRepository) Fail(c context.Context, username, ip string) error {
+	settings, err := l.panel.GetSettings(c)
+	if err != nil {
+		return err
+	}
+	lockout := time.Duration(settings.LoginLockout) * time.Minute
+
+	for kind, subject := range lockoutSubjects(username, ip) {
+		maxFailures := settings.LoginMaxFailures
+		if kind == lockoutKindIP {
+			maxFailures *= ipFailureFactor
+		}
+		var (
+			failure     entities.LoginFailure
+			startedLock bool
+		)
+		err = l.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entities.LoginFailure{
+				Kind:          kind,
+				Subject:       subject,
+				LastFailureAt: now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("kind = ? AND subject = ?", kind, subject).
+				First(&failure).Error
+			if err != nil {
+				return err
+			}
+			if failure.Failures > 0 && now.Sub(failure.LastFailureAt) > failureWindow {
+				failure.Failures = 0
+				failure.Locked = false
+			}
+			wasLocked := failure.Locked && failure.BlockedUntil != nil && failure.BlockedUntil.After(now)
+
+			failure.Failures++
+			failure.LastFailureAt = now
+			delay, locked := loginDelay(failure.Failures, maxFailures, lockout)
+			blockedUntil := now.Add(delay)
+			failure.BlockedUntil = &blockedUntil
+			failure.Locked = locked
+			startedLock = locked && !wasLocked
+			return tx.Save(&failure).Error
+		})
+		if err != nil {
+			return err
+		}
+		if startedLock {
+			l.WorkerEvent.AddEvent(&event.SchemaEvent{
+				EventType: "login_lockout",
+				ModelName: "login_failure",
+				ModelUID:  fmt.Sprintf("%s:%s", kind, subject),
+				UserUID:   event.SystemUserUID,
+				NewState:  failure,
+			})
+		}
+	}
+	return nil
+}
+
+// Succeed reset failures of username after a successful login. Failures of the ip are kept,
+// otherwise one valid account would be enough to guess passwords of others from the same ip.
+func (l *LockoutRepository) Succeed(c context.Context, username string) error {
+	subject := lockoutSubjects(username, "")[lockoutKindUsername]
+	return l.db.WithContext(c).
+		Where("kind = ? AND subject = ?", lockoutKindUsername, subject).
+		Delete(&entities.LoginFailure{}).Error
+}
+
+// Lockouts list locked usernames and ips
+func (l *LockoutRepository) Lockouts(c context.Context) (*[]entities.LoginFailure, error) {
+	var failures []entities.LoginFailure
+	err := l.db.WithContext(c).
+		Where("locked = ? AND blocked_until > ?", true, time.Now()).
+		Order("blocked_until DESC").
+		Find(&failures).Error
+	if err != nil {
+		return nil, err
+	}
+	return &failures, nil
+}
+
+// Clear remove failures and lockout of a username or ip
+func (l *LockoutRepository) Clear(c context.Context, id uint) error {
+	result := l.db.WithContext(c).Delete(&entities.LoginFailure{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ClearAll remove failures and lockouts of all usernames and ips
+func (l *LockoutRepository) ClearAll(c context.Context) error {
+	return l.db.WithContext(c).Where("1 = 1").Delete(&entities.LoginFailure{}).Error
+}
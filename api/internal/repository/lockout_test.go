@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	lockout := 15 * time.Minute
+	cases := []struct {
+		failures int
+		delay    time.Duration
+		locked   bool
+	}{
+		{0, 0, false},
+		{1, time.Second, false},
+		{2, 2 * time.Second, false},
+		{4, 8 * time.Second, false},
+		{5, lockout, true},
+		{6, 2 * lockout, true},
+		{8, 8 * lockout, true},
+		{100, maxLoginLockout, true},
+	}
+	for _, tc := range cases {
+		delay, locked := loginDelay(tc.failures, 5, lockout)
+		assert.Equal(t, tc.delay, delay, "failures %d", tc.failures)
+		assert.Equal(t, tc.locked, locked, "failures %d", tc.failures)
+	}
+}
+
+func TestLoginDelayBackoffCap(t *testing.T) {
+	delay, locked := loginDelay(19, 20, time.Minute)
+	assert.Equal(t, maxLoginBackoff, delay)
+	assert.False(t, locked)
+}
+
+func TestLoginBlockedErrorRetryAfter(t *testing.T) {
+	err := &LoginBlockedError{RetryAfter: 1500 * time.Millisecond}
+	assert.Equal(t, 2, err.RetryAfterSeconds())
+	assert.Contains(t, err.Error(), "retry after 2 seconds")
+}
@@ -87,7 +87,7 @@ func (o *OcservGroupRepository) UpdateDefaultGroup(c context.Context, config *oc
 		EventType: "update_oc_default_group",
 		ModelName: "oc_group",
 		ModelUID:  "",
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 		OldState:  old,
 		NewState:  config,
 	})
@@ -119,7 +119,7 @@ func (o *OcservGroupRepository) CreateOrUpdateGroup(c context.Context, name stri
 		EventType: eventType,
 		ModelName: "oc_group",
 		ModelUID:  name,
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 		OldState:  oldState,
 		NewState:  config,
 	})
@@ -135,7 +135,7 @@ func (o *OcservGroupRepository) DeleteGroup(c context.Context, name string) erro
 		EventType: "delete_oc_group",
 		ModelName: "oc_group",
 		ModelUID:  name,
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 		OldState:  nil,
 		NewState:  nil,
 	})
@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"api/internal/entities"
 	"api/pkg/event"
+	"api/pkg/ocpasswd"
 	"api/pkg/utils"
 	"context"
 	"fmt"
@@ -10,8 +12,10 @@ import (
 	"github.com/mmtaee/go-oc-utils/handler/ocuser"
 	"github.com/mmtaee/go-oc-utils/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"slices"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,19 +23,33 @@ type OcservUserRepository struct {
 	db          *gorm.DB
 	ocUser      ocuser.OcservUserInterface
 	occtl       occtl.OcInterface
+	outbox      *OcUserOutboxRepository
 	WorkerEvent *event.WorkerEvent
 }
 
 type OcservUserRepositoryInterface interface {
-	Users(c context.Context, page utils.RequestPagination) (*[]models.OcUser, *utils.ResponsePagination, error)
+	Users(c context.Context, page utils.RequestPagination, filter *OcUserFilter) (*[]models.OcUser, *utils.ResponsePagination, error)
 	User(c context.Context, username string) (*models.OcUser, error)
 	Create(c context.Context, user *models.OcUser) (*models.OcUser, error)
 	Update(c context.Context, uid string, user *models.OcUser) (*models.OcUser, error)
+	PasswordChanged(c context.Context, uid, password string) (bool, error)
+	SetOwner(c context.Context, uid, ownerUID string) error
 	LockOrUnLock(c context.Context, uid string, lock bool) error
 	Disconnect(c context.Context, uid string) error
 	Delete(c context.Context, uid string) error
 	Statistics(c context.Context, uid string, startDate, endDate time.Time) (*[]Statistics, error)
 	Activity(c context.Context, uid string, date time.Time) (*[]models.OcUserActivity, error)
+	SyncOcpasswd(c context.Context) (int, error)
+	ExistingUsernames(c context.Context, usernames []string) ([]string, error)
+	Bulk(c context.Context, action *BulkAction) ([]BulkResult, error)
+	OcpasswdDrift(c context.Context, entries []ocpasswd.Entry, invalid []ocpasswd.LineError, repair bool) (
+		*OcpasswdDriftReport, error)
+	UserExists(c context.Context, uid string) error
+	ImportOcpasswd(c context.Context, entries []ocpasswd.Entry, invalid []ocpasswd.LineError, groups []string,
+		options *OcpasswdImportOptions) (*OcpasswdImport, error)
+	ExportUsers(c context.Context, filter *OcUserFilter, fn func(user *models.OcUser) error) error
+	ExportStatistics(c context.Context, uid string, start, end time.Time, fn func(record *TrafficRecord) error) error
+	ExportActivities(c context.Context, uid string, start, end time.Time, fn func(activity *models.OcUserActivity) error) error
 }
 
 type Statistics struct {
@@ -45,71 +63,200 @@ func NewOcservUserRepository() *OcservUserRepository {
 		db:          database.Connection(),
 		ocUser:      ocuser.NewOcservUser(),
 		occtl:       occtl.NewOcctl(),
+		outbox:      NewOcUserOutboxRepository(),
 		WorkerEvent: event.GetWorker(),
 	}
 }
 
-func (o *OcservUserRepository) Users(c context.Context, page utils.RequestPagination) (
+// ownerID staff that ocserv users of the request are limited to, zero for admins
+func ownerID(c context.Context) uint {
+	id, _ := c.Value("ownerID").(uint)
+	return id
+}
+
+// ownedOcUsers limit a query on oc_users to the ocserv users owned by the staff of the request
+func ownedOcUsers(c context.Context, tx *gorm.DB) *gorm.DB {
+	return ownedBy(c, tx, "oc_users.id")
+}
+
+// ownedBy limit a query to rows whose ocserv user id column is owned by the staff of the request
+func ownedBy(c context.Context, tx *gorm.DB, column string) *gorm.DB {
+	if owner := ownerID(c); owner != 0 {
+		return tx.Where(column+" IN (SELECT oc_user_id FROM oc_user_owners WHERE user_id = ?)", owner)
+	}
+	return tx
+}
+
+// OcUserFilter conditions on ocserv users, empty fields are not applied. Username matches a
+// substring, dates are YYYY-MM-DD, expire_within is in days from now and usage_above is the
+// percentage of the traffic size used by ocserv users with a traffic limit.
+type OcUserFilter struct {
+	Username     string `json:"username" query:"username" validate:"omitempty,max=16"`
+	Group        string `json:"group" query:"group"`
+	TrafficType  string `json:"traffic_type" query:"traffic_type" validate:"omitempty,oneof=Free MonthlyTransmit MonthlyReceive TotallyTransmit TotallyReceive"`
+	IsLocked     *bool  `json:"is_locked" query:"is_locked"`
+	IsOnline     *bool  `json:"is_online" query:"is_online"`
+	ExpireBefore string `json:"expire_before" query:"expire_before" validate:"omitempty,datetime=2006-01-02"`
+	ExpireAfter  string `json:"expire_after" query:"expire_after" validate:"omitempty,datetime=2006-01-02"`
+	ExpireWithin int    `json:"expire_within" query:"expire_within" validate:"omitempty,min=1,max=3650"`
+	UsageAbove   *int   `json:"usage_above" query:"usage_above" validate:"omitempty,min=0"`
+}
+
+// Empty report whether the filter has no conditions
+func (f *OcUserFilter) Empty() bool {
+	return *f == OcUserFilter{}
+}
+
+// apply add the conditions of the filter to a query on oc_users. online is the usernames of
+// connected ocserv users, it is only used by is_online.
+func (f *OcUserFilter) apply(tx *gorm.DB, now time.Time, online []string) (*gorm.DB, error) {
+	if f.Username != "" {
+		tx = tx.Where("oc_users.username ILIKE ?", "%"+likeEscaper.Replace(f.Username)+"%")
+	}
+	if f.Group != "" {
+		tx = tx.Where(`oc_users."group" = ?`, f.Group)
+	}
+	if f.TrafficType != "" {
+		tx = tx.Where("oc_users.traffic_type = ?", f.TrafficType)
+	}
+	if f.IsLocked != nil {
+		tx = tx.Where("oc_users.is_locked = ?", *f.IsLocked)
+	}
+	if f.IsOnline != nil {
+		switch {
+		case *f.IsOnline && len(online) == 0:
+			tx = tx.Where("1 = 0")
+		case *f.IsOnline:
+			tx = tx.Where("oc_users.username IN ?", online)
+		case len(online) > 0:
+			tx = tx.Where("oc_users.username NOT IN ?", online)
+		}
+	}
+	if f.ExpireBefore != "" {
+		date, err := time.Parse("2006-01-02", f.ExpireBefore)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("oc_users.expire_at < ?", date)
+	}
+	if f.ExpireAfter != "" {
+		date, err := time.Parse("2006-01-02", f.ExpireAfter)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("oc_users.expire_at >= ?", date)
+	}
+	if f.ExpireWithin > 0 {
+		tx = tx.Where("oc_users.expire_at >= ? AND oc_users.expire_at < ?", now, now.AddDate(0, 0, f.ExpireWithin))
+	}
+	if f.UsageAbove != nil {
+		// traffic size is in GB, rx and tx in bytes
+		tx = tx.Where("oc_users.traffic_type <> ? AND oc_users.traffic_size > 0 AND "+
+			"CASE WHEN oc_users.traffic_type IN ? THEN oc_users.tx ELSE oc_users.rx END * 100.0 > "+
+			"? * oc_users.traffic_size * 1073741824.0",
+			models.Free, []string{models.MonthlyTransmit, models.TotallyTransmit}, *f.UsageAbove)
+	}
+	return tx, nil
+}
+
+// ocUserOrders columns that ocserv users can be ordered by
+var ocUserOrders = []string{
+	"id", "username", "group", "traffic_type", "traffic_size", "rx", "tx", "is_locked", "expire_at", "created_at",
+	"updated_at",
+}
+
+// ocUserOrder order of ocserv users by a column of ocUserOrders, so the order is never raw sql
+func ocUserOrder(page utils.RequestPagination) (clause.OrderByColumn, error) {
+	if !slices.Contains(ocUserOrders, page.Order) {
+		return clause.OrderByColumn{}, fmt.Errorf("invalid order. valid orders are: %s", strings.Join(ocUserOrders, ", "))
+	}
+	return clause.OrderByColumn{
+		Column: clause.Column{Table: "oc_users", Name: page.Order},
+		Desc:   page.Sort != "ASC",
+	}, nil
+}
+
+// onlineUsernames usernames of connected ocserv users
+func (o *OcservUserRepository) onlineUsernames(c context.Context) ([]string, error) {
+	onlineUsers, err := o.occtl.OnlineUsers(c)
+	if err != nil {
+		return nil, err
+	}
+	usernames := make([]string, 0, len(*onlineUsers))
+	for _, u := range *onlineUsers {
+		usernames = append(usernames, u.Username)
+	}
+	return usernames, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// MigrateOcUserOwners record the creator of ocserv users created before ownership from the
+// create_oc_user events. Ocserv users without a known creator are only visible to admins.
+func MigrateOcUserOwners(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO oc_user_owners (oc_user_id, user_id, created_at)
+		SELECT oc_users.id, CAST(events.user_uid AS integer), NOW() FROM events
+		JOIN oc_users ON oc_users.uid = events.model_uid
+		WHERE events.event_type = 'create_oc_user' AND events.user_uid ~ '^[0-9]+$'
+		UNION
+		SELECT oc_users.id, api_keys.user_id, NOW() FROM events
+		JOIN oc_users ON oc_users.uid = events.model_uid
+		JOIN api_keys ON events.user_uid = 'api_key:' || api_keys.uid
+		WHERE events.event_type = 'create_oc_user'
+		ON CONFLICT (oc_user_id) DO NOTHING`).Error
+}
+
+// Users ocserv users of the filter with their online state, limited to the owner of the request
+func (o *OcservUserRepository) Users(c context.Context, page utils.RequestPagination, filter *OcUserFilter) (
 	*[]models.OcUser, *utils.ResponsePagination, error,
 ) {
 	var (
-		users             []models.OcUser
-		totalRecords      int64
-		ocservOnlineUsers []string
+		users        []models.OcUser
+		totalRecords int64
 	)
 	pageResponse := utils.NewPaginationResponse()
 	pageResponse.Page = page.Page
 	pageResponse.PageSize = page.PageSize
-	if err := o.db.WithContext(c).Model(&models.User{}).Count(&totalRecords).Error; err != nil {
+	order, err := ocUserOrder(page)
+	if err != nil {
+		return nil, nil, err
+	}
+	var onlineUsers []string
+	if filter.IsOnline != nil {
+		if onlineUsers, err = o.onlineUsernames(c); err != nil {
+			return nil, nil, err
+		}
+	}
+	query, err := filter.apply(ownedOcUsers(c, o.db.WithContext(c).Table("oc_users")), time.Now(), onlineUsers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = query.Session(&gorm.Session{}).Count(&totalRecords).Error; err != nil {
 		return nil, nil, err
 	}
 	if totalRecords == 0 {
 		return &users, pageResponse, nil
 	}
 	pageResponse.TotalRecords = int(totalRecords)
-
-	ch := make(chan error, 1)
-	go func() {
-		onlineUsers, err := o.occtl.OnlineUsers(c)
-		if err != nil {
-			ch <- err
-			return
+	if filter.IsOnline == nil {
+		if onlineUsers, err = o.onlineUsernames(c); err != nil {
+			return nil, pageResponse, err
 		}
-		for _, u := range *onlineUsers {
-			ocservOnlineUsers = append(ocservOnlineUsers, u.Username)
-		}
-		ch <- nil
-	}()
-	if err := <-ch; err != nil {
-		return nil, pageResponse, err
 	}
 
 	offset := (page.Page - 1) * page.PageSize
-	order := fmt.Sprintf("%s %s", page.Order, page.Sort)
-	if err := o.db.WithContext(c).Table("oc_users").
-		Order(order).Limit(page.PageSize).Offset(offset).Scan(&users).Error; err != nil {
+	if err = query.Order(order).Limit(page.PageSize).Offset(offset).Scan(&users).Error; err != nil {
 		return nil, pageResponse, err
 	}
-
-	var wg sync.WaitGroup
-	wg.Add(len(users))
 	for i := range users {
-		user := users[i]
-		go func(user *models.OcUser) {
-			defer wg.Done()
-			if slices.Contains(ocservOnlineUsers, user.Username) {
-				user.IsOnline = true
-			}
-		}(&user)
+		users[i].IsOnline = slices.Contains(onlineUsers, users[i].Username)
 	}
-	wg.Wait()
-
 	return &users, pageResponse, nil
 }
 
 func (o *OcservUserRepository) User(c context.Context, uid string) (*models.OcUser, error) {
 	var user models.OcUser
-	err := o.db.WithContext(c).Table("oc_users").Where("uid = ?", uid).First(&user).Error
+	err := ownedOcUsers(c, o.db.WithContext(c).Table("oc_users")).Where("uid = ?", uid).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
@@ -121,30 +268,37 @@ func (o *OcservUserRepository) User(c context.Context, uid string) (*models.OcUs
 	return &user, nil
 }
 
+// Create add the ocserv user within the quota of the staff of the request, who owns it. The
+// ocpasswd entry is written by an operation of the outbox after the row is committed.
 func (o *OcservUserRepository) Create(c context.Context, user *models.OcUser) (*models.OcUser, error) {
-	tx := o.db.WithContext(c).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		} else if tx.Error != nil {
-			tx.Rollback()
+	var op entities.OcUserOperation
+	err := o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := enforceQuota(c, tx, user, nil); err != nil {
+			return err
 		}
-	}()
-	if err := tx.Table("oc_users").Create(user).Error; err != nil {
-		return nil, err
-	}
-	if err := o.ocUser.Create(c, user.Username, user.Password, user.Group); err != nil {
-		return nil, err
-	}
-	if err := tx.Commit().Error; err != nil {
+		if err := tx.Table("oc_users").Create(user).Error; err != nil {
+			return err
+		}
+		actor, _ := c.Value("userID").(string)
+		if userID, err := strconv.Atoi(actor); err == nil {
+			if err = tx.Create(&entities.OcUserOwner{OcUserID: user.ID, UserID: uint(userID)}).Error; err != nil {
+				return err
+			}
+		}
+		var err error
+		op, err = enqueueOperation(tx, OperationCreate, user)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
+	o.outbox.Apply(c, []entities.OcUserOperation{op})
 
 	o.WorkerEvent.AddEvent(&event.SchemaEvent{
 		EventType: "create_oc_user",
 		ModelName: "oc_user",
 		ModelUID:  user.UID,
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 		OldState:  nil,
 		NewState:  user,
 	})
@@ -152,48 +306,110 @@ func (o *OcservUserRepository) Create(c context.Context, user *models.OcUser) (*
 	return user, nil
 }
 
-func (o *OcservUserRepository) Update(c context.Context, uid string, user *models.OcUser) (*models.OcUser, error) {
-	var existing models.OcUser
-
-	tx := o.db.WithContext(c).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		} else if tx.Error != nil {
-			tx.Rollback()
-		}
-	}()
+// PasswordChanged report whether password differs from the current password of the ocserv user
+func (o *OcservUserRepository) PasswordChanged(c context.Context, uid, password string) (bool, error) {
+	var user models.OcUser
+	err := ownedOcUsers(c, o.db.WithContext(c).Table("oc_users")).Select("password").Where("uid = ?", uid).First(&user).Error
+	if err != nil {
+		return false, err
+	}
+	return user.Password != password, nil
+}
 
-	if err := tx.Table("oc_users").Where("uid = ?", uid).First(&existing).Error; err != nil {
-		return nil, err
+// SetOwner assign the ocserv user to the staff user of ownerUID
+func (o *OcservUserRepository) SetOwner(c context.Context, uid, ownerUID string) error {
+	var (
+		user     models.OcUser
+		owner    models.User
+		oldOwner string
+	)
+	err := o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("oc_users").Select("id").Where("uid = ?", uid).First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("id", "uid").Where("uid = ?", ownerUID).First(&owner).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.User{}).
+			Joins("JOIN oc_user_owners ON oc_user_owners.user_id = users.id").
+			Where("oc_user_owners.oc_user_id = ?", user.ID).
+			Select("users.uid").
+			Scan(&oldOwner).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "oc_user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id"}),
+		}).Create(&entities.OcUserOwner{OcUserID: user.ID, UserID: owner.ID}).Error
+	})
+	if err != nil {
+		return err
 	}
+	o.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "update_oc_user_owner",
+		ModelName: "oc_user",
+		ModelUID:  uid,
+		UserUID:   actorUID(c),
+		OldState:  oldOwner,
+		NewState:  owner.UID,
+	})
+	return nil
+}
 
-	oldState := existing
+// Update change the ocserv user within the quota of the staff of the request
+func (o *OcservUserRepository) Update(c context.Context, uid string, user *models.OcUser) (*models.OcUser, error) {
+	var (
+		existing models.OcUser
+		oldState models.OcUser
+		ops      []entities.OcUserOperation
+	)
+	err := o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := ownedOcUsers(c, tx.Table("oc_users")).Where("uid = ?", uid).First(&existing).Error; err != nil {
+			return err
+		}
+		if err := enforceQuota(c, tx, user, &existing); err != nil {
+			return err
+		}
 
-	existing.Group = user.Group
-	existing.Username = user.Username
-	existing.Password = user.Password
-	existing.ExpireAt = user.ExpireAt
-	existing.TrafficType = user.TrafficType
-	existing.TrafficSize = user.TrafficSize
+		oldState = existing
 
-	if err := tx.Table("oc_users").Save(&existing).Error; err != nil {
-		return nil, err
-	}
+		existing.Group = user.Group
+		existing.Username = user.Username
+		existing.Password = user.Password
+		existing.ExpireAt = user.ExpireAt
+		existing.TrafficType = user.TrafficType
+		existing.TrafficSize = user.TrafficSize
 
-	if err := o.ocUser.Update(c, user.Username, user.Password, user.Group); err != nil {
-		return nil, err
-	}
+		if err := tx.Table("oc_users").Save(&existing).Error; err != nil {
+			return err
+		}
 
-	if err := tx.Commit().Error; err != nil {
+		if oldState.Username != existing.Username {
+			// the entry of the old username is deleted, the user has no row of it anymore
+			op, err := enqueueOperation(tx, OperationDelete, &oldState)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, op)
+		}
+		op, err := enqueueOperation(tx, OperationUpdate, &existing)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, op)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
+	o.outbox.Apply(c, ops)
 
 	o.WorkerEvent.AddEvent(&event.SchemaEvent{
 		EventType: "update_oc_user",
 		ModelName: "oc_user",
 		ModelUID:  uid,
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 		OldState:  oldState,
 		NewState:  existing,
 	})
@@ -202,40 +418,31 @@ func (o *OcservUserRepository) Update(c context.Context, uid string, user *model
 }
 
 func (o *OcservUserRepository) LockOrUnLock(c context.Context, uid string, lock bool) error {
-	user := models.OcUser{}
-	tx := o.db.WithContext(c).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		} else if tx.Error != nil {
-			tx.Rollback()
-		}
-	}()
-
-	if err := tx.Table("oc_users").Where("uid = ?", uid).First(&user).Error; err != nil {
-		return err
-	}
-	if lock {
-		user.IsLocked = true
-	} else {
-		user.IsLocked = false
-	}
-	if err := tx.Table("oc_users").Save(&user).Error; err != nil {
-		return err
-	}
-
-	if user.IsLocked {
-		if err := o.ocUser.Lock(c, user.Username); err != nil {
+	var (
+		user models.OcUser
+		op   entities.OcUserOperation
+	)
+	err := o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := ownedOcUsers(c, tx.Table("oc_users")).Where("uid = ?", uid).First(&user).Error; err != nil {
 			return err
 		}
-	} else {
-		if err := o.ocUser.UnLock(c, user.Username); err != nil {
+		user.IsLocked = lock
+		if err := tx.Table("oc_users").Save(&user).Error; err != nil {
 			return err
 		}
-	}
-	if err := tx.Commit().Error; err != nil {
+
+		kind := OperationUnlock
+		if user.IsLocked {
+			kind = OperationLock
+		}
+		var err error
+		op, err = enqueueOperation(tx, kind, &user)
+		return err
+	})
+	if err != nil {
 		return err
 	}
+	o.outbox.Apply(c, []entities.OcUserOperation{op})
 
 	var eventType, newState, oldState string
 
@@ -252,7 +459,7 @@ func (o *OcservUserRepository) LockOrUnLock(c context.Context, uid string, lock
 		EventType: eventType,
 		ModelName: "oc_user",
 		ModelUID:  uid,
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 		OldState:  oldState,
 		NewState:  newState,
 	})
@@ -262,52 +469,54 @@ func (o *OcservUserRepository) LockOrUnLock(c context.Context, uid string, lock
 
 func (o *OcservUserRepository) Disconnect(c context.Context, uid string) error {
 	user := models.OcUser{}
-	err := o.db.WithContext(c).Table("oc_users").Where("uid = ?", uid).First(&user).Error
+	err := ownedOcUsers(c, o.db.WithContext(c).Table("oc_users")).Where("uid = ?", uid).First(&user).Error
 	if err != nil {
 		return err
 	}
-	err = o.occtl.Disconnect(c, user.Username)
+	op, err := enqueueOperation(o.db.WithContext(c), OperationDisconnect, &user)
 	if err != nil {
 		return err
 	}
+	o.outbox.Apply(c, []entities.OcUserOperation{op})
 	o.WorkerEvent.AddEvent(&event.SchemaEvent{
 		EventType: "disconnect_oc_user",
 		ModelName: "oc_user",
 		ModelUID:  uid,
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 		OldState:  nil,
 		NewState:  nil,
 	})
 	return nil
 }
 func (o *OcservUserRepository) Delete(c context.Context, uid string) error {
-	var user models.OcUser
-	tx := o.db.WithContext(c).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		} else if tx.Error != nil {
-			tx.Rollback()
+	var (
+		user models.OcUser
+		op   entities.OcUserOperation
+	)
+	err := o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := ownedOcUsers(c, tx.Table("oc_users")).Where("uid = ?", uid).First(&user).Error; err != nil {
+			return err
 		}
-	}()
-	if err := tx.Where("uid = ?", uid).First(&user).Error; err != nil {
-		return err
-	}
-	if err := tx.Table("oc_users").Where("uid = ?", uid).Delete(&user).Error; err != nil {
-		return err
-	}
-	if err := o.ocUser.Delete(c, user.Username); err != nil {
+		if err := tx.Table("oc_users").Where("uid = ?", uid).Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("oc_user_id = ?", user.ID).Delete(&entities.OcUserOwner{}).Error; err != nil {
+			return err
+		}
+		var err error
+		op, err = enqueueOperation(tx, OperationDelete, &user)
 		return err
-	}
-	if err := tx.Commit().Error; err != nil {
+	})
+	if err != nil {
 		return err
 	}
+	o.outbox.Apply(c, []entities.OcUserOperation{op})
 
 	o.WorkerEvent.AddEvent(&event.SchemaEvent{
 		EventType: "delete_oc_user",
 		ModelName: "oc_user",
 		ModelUID:  uid,
-		UserUID:   c.Value("userID").(string),
+		UserUID:   actorUID(c),
 	})
 
 	return nil
@@ -317,7 +526,7 @@ func (o *OcservUserRepository) Statistics(c context.Context, uid string, startDa
 	*[]Statistics, error,
 ) {
 	var results []Statistics
-	err := o.db.WithContext(c).
+	err := ownedOcUsers(c, o.db.WithContext(c)).
 		Table("oc_user_traffic_statistics").
 		Joins("JOIN oc_users ON oc_users.id = oc_user_traffic_statistics.oc_user_id").
 		Where("oc_users.uid = ? AND oc_user_traffic_statistics.created_at BETWEEN ? AND ?", uid, startDate, endDate).
@@ -339,7 +548,7 @@ func (o *OcservUserRepository) Activity(c context.Context, uid string, date time
 	var activities []models.OcUserActivity
 	startOfDay := date.Format("2006-01-02") + " 00:00:00"
 	endOfDay := date.Format("2006-01-02") + " 23:59:59"
-	err := o.db.WithContext(c).Table("oc_user_activities").
+	err := ownedOcUsers(c, o.db.WithContext(c)).Table("oc_user_activities").
 		Joins("JOIN oc_users ON oc_users.id = oc_user_activities.oc_user_id").
 		Where("oc_users.uid = ? AND oc_user_activities.created_at BETWEEN ? AND ?", uid, startOfDay, endOfDay).
 		Order("oc_user_activities.created_at").
@@ -349,3 +558,38 @@ func (o *OcservUserRepository) Activity(c context.Context, uid string, date time
 	}
 	return &activities, nil
 }
+
+// SyncOcpasswd write password, group and lock state of every ocserv user to ocpasswd and return
+// the number of written users. Only the lock state is written for users without a password. It
+// stops at the first user that fails.
+func (o *OcservUserRepository) SyncOcpasswd(c context.Context) (int, error) {
+	var users []models.OcUser
+	if err := o.db.WithContext(c).Table("oc_users").Order("id").Find(&users).Error; err != nil {
+		return 0, err
+	}
+	for i, user := range users {
+		// users imported from ocpasswd keep their entry until a password is set
+		if user.Password != "" {
+			if err := o.ocUser.Update(c, user.Username, user.Password, user.Group); err != nil {
+				return i, fmt.Errorf("ocserv user %s: %w", user.Username, err)
+			}
+		}
+		if err := writeLockState(c, o.ocUser, &user); err != nil {
+			return i, fmt.Errorf("ocserv user %s: %w", user.Username, err)
+		}
+	}
+	return len(users), nil
+}
+
+// ExistingUsernames usernames that are already taken by ocserv users of any staff
+func (o *OcservUserRepository) ExistingUsernames(c context.Context, usernames []string) ([]string, error) {
+	existing := []string{}
+	if len(usernames) == 0 {
+		return existing, nil
+	}
+	err := o.db.WithContext(c).Table("oc_users").Where("username IN ?", usernames).Pluck("username", &existing).Error
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"slices"
+	"sync"
+	"time"
+)
+
+// errUnknownPassword ocserv user imported from ocpasswd can not be written to ocpasswd again
+// without its password
+var errUnknownPassword = errors.New("password of the ocserv user is unknown, it must be set before it is written to ocpasswd")
+
+// Bulk actions on ocserv users
+const (
+	BulkLock         = "lock"
+	BulkUnlock       = "unlock"
+	BulkDisconnect   = "disconnect"
+	BulkDelete       = "delete"
+	BulkSetGroup     = "set_group"
+	BulkExtendExpiry = "extend_expiry"
+)
+
+const (
+	// MaxBulkItems ocserv users of a bulk action
+	MaxBulkItems = 1000
+	// bulkConcurrency ocserv users changed at the same time, every change runs ocpasswd or occtl
+	bulkConcurrency = 4
+)
+
+// BulkAction action on the ocserv users of uids or of filter. Group is the new group of
+// set_group, which must be the default group or one of Groups, and Days the days added to the
+// expiry by extend_expiry.
+type BulkAction struct {
+	Action string
+	UIDs   []string
+	Filter *OcUserFilter
+	Group  string
+	Groups []string
+	Days   int
+}
+
+// BulkResult result of a bulk action on an ocserv user, error is empty on success
+type BulkResult struct {
+	UID   string `json:"uid"`
+	Error string `json:"error,omitempty"`
+}
+
+// BulkEvent state of the bulk_oc_users event
+type BulkEvent struct {
+	Action    string `json:"action"`
+	Group     string `json:"group,omitempty"`
+	Days      int    `json:"days,omitempty"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+}
+
+// bulkUIDs uids of the ocserv users of the filter, limited to the owner of the request
+func (o *OcservUserRepository) bulkUIDs(c context.Context, filter *OcUserFilter) ([]string, error) {
+	var online []string
+	if filter.IsOnline != nil {
+		var err error
+		if online, err = o.onlineUsernames(c); err != nil {
+			return nil, err
+		}
+	}
+	tx, err := filter.apply(ownedOcUsers(c, o.db.WithContext(c).Table("oc_users")), time.Now(), online)
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	if err = tx.Order("oc_users.id").Limit(MaxBulkItems+1).Pluck("oc_users.uid", &uids).Error; err != nil {
+		return nil, err
+	}
+	if len(uids) > MaxBulkItems {
+		return nil, fmt.Errorf("filter matches more than %d ocserv users", MaxBulkItems)
+	}
+	return uids, nil
+}
+
+// Bulk run action on every ocserv user, at most bulkConcurrency at the same time. Every user
+// gets the event of its change, and a bulk_oc_users event summarizes the results.
+func (o *OcservUserRepository) Bulk(c context.Context, action *BulkAction) ([]BulkResult, error) {
+	run, err := o.bulkFunc(action)
+	if err != nil {
+		return nil, err
+	}
+	uids := action.UIDs
+	if action.Filter != nil {
+		if uids, err = o.bulkUIDs(c, action.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]BulkResult, len(uids))
+	sem := make(chan struct{}, bulkConcurrency)
+	var wg sync.WaitGroup
+	for i, uid := range uids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, uid string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i].UID = uid
+			if err := run(c, uid); err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, uid)
+	}
+	wg.Wait()
+
+	summary := BulkEvent{Action: action.Action, Group: action.Group, Days: action.Days, Total: len(results)}
+	for _, result := range results {
+		if result.Error == "" {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+	o.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "bulk_oc_users",
+		ModelName: "oc_user",
+		ModelUID:  action.Action,
+		UserUID:   actorUID(c),
+		NewState:  summary,
+	})
+	return results, nil
+}
+
+func (o *OcservUserRepository) bulkFunc(action *BulkAction) (func(c context.Context, uid string) error, error) {
+	switch action.Action {
+	case BulkLock, BulkUnlock:
+		lock := action.Action == BulkLock
+		return func(c context.Context, uid string) error {
+			return o.LockOrUnLock(c, uid, lock)
+		}, nil
+	case BulkDisconnect:
+		return o.Disconnect, nil
+	case BulkDelete:
+		return o.Delete, nil
+	case BulkSetGroup:
+		if action.Group == "" {
+			return nil, errors.New("group is required")
+		}
+		if action.Group != DefaultGroup && !slices.Contains(action.Groups, action.Group) {
+			return nil, fmt.Errorf("group %s does not exist", action.Group)
+		}
+		return func(c context.Context, uid string) error {
+			return o.modify(c, uid, func(user *models.OcUser) {
+				user.Group = action.Group
+			})
+		}, nil
+	case BulkExtendExpiry:
+		if action.Days < 1 {
+			return nil, errors.New("days must be at least 1")
+		}
+		return func(c context.Context, uid string) error {
+			return o.modify(c, uid, func(user *models.OcUser) {
+				user.ExpireAt = extendExpiry(user.ExpireAt, action.Days, time.Now())
+			})
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown bulk action %s", action.Action)
+}
+
+// extendExpiry add days to expireAt, or to now when the ocserv user has already expired
+func extendExpiry(expireAt *time.Time, days int, now time.Time) *time.Time {
+	base := now
+	if expireAt != nil && expireAt.After(now) {
+		base = *expireAt
+	}
+	extended := base.AddDate(0, 0, days)
+	return &extended
+}
+
+// modify change fields of the ocserv user within the quota of the staff of the request and
+// write its group to ocpasswd
+func (o *OcservUserRepository) modify(c context.Context, uid string, change func(user *models.OcUser)) error {
+	var (
+		oldState, user models.OcUser
+		ops            []entities.OcUserOperation
+	)
+	err := o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := ownedOcUsers(c, tx.Table("oc_users")).Where("uid = ?", uid).First(&oldState).Error; err != nil {
+			return err
+		}
+		user = oldState
+		change(&user)
+		if err := enforceQuota(c, tx, &user, &oldState); err != nil {
+			return err
+		}
+		if err := tx.Table("oc_users").Save(&user).Error; err != nil {
+			return err
+		}
+		if user.Group == oldState.Group {
+			return nil
+		}
+		if user.Password == "" {
+			return errUnknownPassword
+		}
+		op, err := enqueueOperation(tx, OperationUpdate, &user)
+		ops = append(ops, op)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	o.outbox.Apply(c, ops)
+	o.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "update_oc_user",
+		ModelName: "oc_user",
+		ModelUID:  uid,
+		UserUID:   actorUID(c),
+		OldState:  oldState,
+		NewState:  user,
+	})
+	return nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExtendExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	later := now.AddDate(0, 0, 5)
+	earlier := now.AddDate(0, 0, -5)
+
+	assert.Equal(t, now.AddDate(0, 0, 35), *extendExpiry(&later, 30, now))
+	assert.Equal(t, now.AddDate(0, 0, 30), *extendExpiry(&earlier, 30, now))
+	assert.Equal(t, now.AddDate(0, 0, 30), *extendExpiry(nil, 30, now))
+}
+
+func TestBulkFunc(t *testing.T) {
+	o := &OcservUserRepository{}
+	for _, action := range []string{BulkLock, BulkUnlock, BulkDisconnect, BulkDelete} {
+		run, err := o.bulkFunc(&BulkAction{Action: action})
+		assert.NoError(t, err, action)
+		assert.NotNil(t, run, action)
+	}
+	_, err := o.bulkFunc(&BulkAction{Action: BulkSetGroup})
+	assert.EqualError(t, err, "group is required")
+	_, err = o.bulkFunc(&BulkAction{Action: BulkSetGroup, Group: "staff", Groups: []string{"sales"}})
+	assert.EqualError(t, err, "group staff does not exist")
+	for _, group := range []string{"sales", DefaultGroup} {
+		run, err := o.bulkFunc(&BulkAction{Action: BulkSetGroup, Group: group, Groups: []string{"sales"}})
+		assert.NoError(t, err, group)
+		assert.NotNil(t, run, group)
+	}
+	_, err = o.bulkFunc(&BulkAction{Action: BulkExtendExpiry})
+	assert.EqualError(t, err, "days must be at least 1")
+	_, err = o.bulkFunc(&BulkAction{Action: "rename"})
+	assert.EqualError(t, err, "unknown bulk action rename")
+}
+
+func TestOcUserFilterEmpty(t *testing.T) {
+	locked := false
+	assert.True(t, (&OcUserFilter{}).Empty())
+	assert.False(t, (&OcUserFilter{IsLocked: &locked}).Empty())
+	assert.False(t, (&OcUserFilter{Group: "defaults"}).Empty())
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"api/pkg/event"
+	"api/pkg/ocpasswd"
+	"context"
+	"github.com/mmtaee/go-oc-utils/handler/ocuser"
+	"github.com/mmtaee/go-oc-utils/models"
+	"sort"
+	"time"
+)
+
+// Kinds of drift between the database and ocpasswd
+const (
+	DriftMissing = "missing" // ocserv user has no ocpasswd entry
+	DriftOrphan  = "orphan"  // ocpasswd entry has no ocserv user
+	DriftLock    = "lock"
+	DriftGroup   = "group"
+)
+
+// OcpasswdDrift difference of an ocserv user between the database and ocpasswd. Database and
+// Ocpasswd are the lock state or the group of the user on each side.
+type OcpasswdDrift struct {
+	Username string `json:"username"`
+	UID      string `json:"uid,omitempty"`
+	Kind     string `json:"kind" enums:"missing,orphan,lock,group"`
+	Database string `json:"database,omitempty"`
+	Ocpasswd string `json:"ocpasswd,omitempty"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+// OcpasswdDriftReport drifts of ocpasswd and the invalid lines of the file, which are never
+// repaired
+type OcpasswdDriftReport struct {
+	CheckedAt time.Time          `json:"checked_at"`
+	Repair    bool               `json:"repair"`
+	Drifts    []OcpasswdDrift    `json:"drifts"`
+	Invalid   []OcpasswdConflict `json:"invalid"`
+}
+
+// ocpasswdGroup group of an ocpasswd entry as it is stored in the database
+func ocpasswdGroup(group string) string {
+	if group == "" || group == ocpasswd.NoGroup {
+		return DefaultGroup
+	}
+	return group
+}
+
+func lockState(locked bool) string {
+	if locked {
+		return "locked"
+	}
+	return "unlocked"
+}
+
+// diffOcpasswd drifts of ocpasswd entries from users ordered by username. The first entry of a
+// username is the one ocserv uses, so later duplicates are ignored.
+func diffOcpasswd(users []models.OcUser, entries []ocpasswd.Entry) []OcpasswdDrift {
+	byUsername := make(map[string]ocpasswd.Entry, len(entries))
+	for _, entry := range entries {
+		if _, ok := byUsername[entry.Username]; !ok {
+			byUsername[entry.Username] = entry
+		}
+	}
+	drifts := []OcpasswdDrift{}
+	for _, user := range users {
+		entry, ok := byUsername[user.Username]
+		if !ok {
+			drifts = append(drifts, OcpasswdDrift{Username: user.Username, UID: user.UID, Kind: DriftMissing})
+			continue
+		}
+		delete(byUsername, user.Username)
+		if group := ocpasswdGroup(entry.Group); group != ocpasswdGroup(user.Group) {
+			drifts = append(drifts, OcpasswdDrift{
+				Username: user.Username,
+				UID:      user.UID,
+				Kind:     DriftGroup,
+				Database: ocpasswdGroup(user.Group),
+				Ocpasswd: group,
+			})
+		}
+		if entry.Locked != user.IsLocked {
+			drifts = append(drifts, OcpasswdDrift{
+				Username: user.Username,
+				UID:      user.UID,
+				Kind:     DriftLock,
+				Database: lockState(user.IsLocked),
+				Ocpasswd: lockState(entry.Locked),
+			})
+		}
+	}
+	for username := range byUsername {
+		drifts = append(drifts, OcpasswdDrift{Username: username, Kind: DriftOrphan})
+	}
+	sort.SliceStable(drifts, func(i, j int) bool {
+		return drifts[i].Username < drifts[j].Username
+	})
+	return drifts
+}
+
+// OcpasswdDrift compare existence, lock state and group of every ocserv user with the entries
+// of ocpasswd. With repair, ocpasswd is changed to match the database: missing entries are
+// created, orphan entries deleted and lock state and group rewritten. Users without a password
+// can not be written to ocpasswd, so their missing entries and groups are left as they are.
+// An event is recorded when ocpasswd drifted.
+func (o *OcservUserRepository) OcpasswdDrift(c context.Context, entries []ocpasswd.Entry, invalid []ocpasswd.LineError,
+	repair bool,
+) (*OcpasswdDriftReport, error) {
+	var users []models.OcUser
+	if err := o.db.WithContext(c).Table("oc_users").Order("username").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	report := &OcpasswdDriftReport{
+		CheckedAt: time.Now(),
+		Repair:    repair,
+		Drifts:    diffOcpasswd(users, entries),
+		Invalid:   []OcpasswdConflict{},
+	}
+	for _, line := range invalid {
+		report.Invalid = append(report.Invalid, OcpasswdConflict{Line: line.Line, Reason: line.Reason})
+	}
+	if repair {
+		o.repairOcpasswd(c, users, report.Drifts)
+	}
+	if len(report.Drifts) > 0 {
+		o.WorkerEvent.AddEvent(&event.SchemaEvent{
+			EventType: "ocpasswd_drift",
+			ModelName: "oc_user",
+			ModelUID:  "ocpasswd",
+			UserUID:   actorUID(c),
+			NewState:  report,
+		})
+	}
+	return report, nil
+}
+
+// repairOcpasswd write users to ocpasswd for drifts and record the outcome on each drift. A
+// failed drift does not stop the others.
+func (o *OcservUserRepository) repairOcpasswd(c context.Context, users []models.OcUser, drifts []OcpasswdDrift) {
+	byUsername := make(map[string]*models.OcUser, len(users))
+	for i := range users {
+		byUsername[users[i].Username] = &users[i]
+	}
+	for i := range drifts {
+		drift := &drifts[i]
+		var err error
+		switch user := byUsername[drift.Username]; drift.Kind {
+		case DriftOrphan:
+			err = o.ocUser.Delete(c, drift.Username)
+		case DriftLock:
+			err = writeLockState(c, o.ocUser, user)
+		case DriftMissing, DriftGroup:
+			if user.Password == "" {
+				err = errUnknownPassword
+				break
+			}
+			if drift.Kind == DriftMissing {
+				err = o.ocUser.Create(c, user.Username, user.Password, user.Group)
+			} else {
+				err = o.ocUser.Update(c, user.Username, user.Password, user.Group)
+			}
+			// the new entry has a new hash, so it is not locked anymore
+			if err == nil && user.IsLocked {
+				err = o.ocUser.Lock(c, user.Username)
+			}
+		}
+		if err != nil {
+			drift.Error = err.Error()
+			continue
+		}
+		drift.Repaired = true
+	}
+}
+
+// writeLockState lock or unlock the ocpasswd entry of the ocserv user as it is in the database
+func writeLockState(c context.Context, ocUser ocuser.OcservUserInterface, user *models.OcUser) error {
+	if user.IsLocked {
+		return ocUser.Lock(c, user.Username)
+	}
+	return ocUser.UnLock(c, user.Username)
+}
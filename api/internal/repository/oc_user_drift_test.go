@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"api/pkg/ocpasswd"
+	"context"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fakeOcUser record ocpasswd commands instead of running them
+type fakeOcUser struct {
+	calls []string
+	fail  string
+}
+
+func (f *fakeOcUser) call(name, username string) error {
+	f.calls = append(f.calls, name+" "+username)
+	if username == f.fail {
+		return errors.New("ocpasswd failed")
+	}
+	return nil
+}
+
+func (f *fakeOcUser) Create(_ context.Context, username, _, _ string) error {
+	return f.call("create", username)
+}
+
+func (f *fakeOcUser) Update(_ context.Context, username, _, _ string) error {
+	return f.call("update", username)
+}
+
+func (f *fakeOcUser) Lock(_ context.Context, username string) error {
+	return f.call("lock", username)
+}
+
+func (f *fakeOcUser) UnLock(_ context.Context, username string) error {
+	return f.call("unlock", username)
+}
+
+func (f *fakeOcUser) Delete(_ context.Context, username string) error {
+	return f.call("delete", username)
+}
+
+func driftUsers() []models.OcUser {
+	return []models.OcUser{
+		{UID: "1", Username: "alice", Password: "secret", Group: DefaultGroup},
+		{UID: "2", Username: "bob", Password: "secret", Group: "staff", IsLocked: true},
+		{UID: "3", Username: "carol", Password: "secret", Group: DefaultGroup, IsLocked: true},
+		{UID: "4", Username: "dave", Group: DefaultGroup},
+	}
+}
+
+func TestDiffOcpasswd(t *testing.T) {
+	entries := []ocpasswd.Entry{
+		{Line: 1, Username: "alice", Group: ocpasswd.NoGroup},
+		{Line: 2, Username: "bob", Group: "*", Locked: false},
+		{Line: 3, Username: "eve", Group: "staff"},
+		{Line: 4, Username: "alice", Group: "staff", Locked: true},
+	}
+	assert.Equal(t, []OcpasswdDrift{
+		{Username: "bob", UID: "2", Kind: DriftGroup, Database: "staff", Ocpasswd: DefaultGroup},
+		{Username: "bob", UID: "2", Kind: DriftLock, Database: "locked", Ocpasswd: "unlocked"},
+		{Username: "carol", UID: "3", Kind: DriftMissing},
+		{Username: "dave", UID: "4", Kind: DriftMissing},
+		{Username: "eve", Kind: DriftOrphan},
+	}, diffOcpasswd(driftUsers(), entries))
+
+	assert.Empty(t, diffOcpasswd(driftUsers()[:1], entries[:1]))
+}
+
+func TestRepairOcpasswd(t *testing.T) {
+	fake := &fakeOcUser{fail: "eve"}
+	o := &OcservUserRepository{ocUser: fake}
+	drifts := []OcpasswdDrift{
+		{Username: "bob", Kind: DriftGroup},
+		{Username: "bob", Kind: DriftLock},
+		{Username: "carol", Kind: DriftMissing},
+		{Username: "dave", Kind: DriftMissing},
+		{Username: "eve", Kind: DriftOrphan},
+	}
+	o.repairOcpasswd(context.Background(), driftUsers(), drifts)
+
+	assert.Equal(t, []string{
+		"update bob", "lock bob", "lock bob", "create carol", "lock carol", "delete eve",
+	}, fake.calls)
+	for _, drift := range drifts[:3] {
+		assert.True(t, drift.Repaired, drift.Username)
+		assert.Empty(t, drift.Error, drift.Username)
+	}
+	assert.False(t, drifts[3].Repaired)
+	assert.Equal(t, errUnknownPassword.Error(), drifts[3].Error)
+	assert.False(t, drifts[4].Repaired)
+	assert.Equal(t, "ocpasswd failed", drifts[4].Error)
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"slices"
+	"time"
+)
+
+// TrafficRecord traffic of an ocserv user in bytes, as reported at the end of a session
+type TrafficRecord struct {
+	CreatedAt time.Time `json:"created_at"`
+	Rx        int64     `json:"rx"`
+	Tx        int64     `json:"tx"`
+}
+
+// eachRow scan the rows of query one at a time, so exports never load a table in memory
+func eachRow[T any](query *gorm.DB, fn func(row *T) error) error {
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row T
+		if err = query.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err = fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// UserExists return gorm.ErrRecordNotFound when the ocserv user does not exist or is not owned by
+// the staff of the request, so exports can fail before they start
+func (o *OcservUserRepository) UserExists(c context.Context, uid string) error {
+	var count int64
+	if err := ownedOcUsers(c, o.db.WithContext(c).Table("oc_users")).Where("uid = ?", uid).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ExportUsers call fn for every ocserv user of the filter, with its online state, limited to
+// the owner of the request
+func (o *OcservUserRepository) ExportUsers(c context.Context, filter *OcUserFilter, fn func(user *models.OcUser) error) error {
+	online, err := o.onlineUsernames(c)
+	if err != nil {
+		return err
+	}
+	query, err := filter.apply(ownedOcUsers(c, o.db.WithContext(c).Table("oc_users")), time.Now(), online)
+	if err != nil {
+		return err
+	}
+	return eachRow(query.Order("oc_users.id"), func(user *models.OcUser) error {
+		user.IsOnline = slices.Contains(online, user.Username)
+		return fn(user)
+	})
+}
+
+// ExportStatistics call fn for every traffic record of the ocserv user between start and end
+func (o *OcservUserRepository) ExportStatistics(c context.Context, uid string, start, end time.Time,
+	fn func(record *TrafficRecord) error,
+) error {
+	query := ownedOcUsers(c, o.db.WithContext(c)).
+		Table("oc_user_traffic_statistics").
+		Joins("JOIN oc_users ON oc_users.id = oc_user_traffic_statistics.oc_user_id").
+		Where("oc_users.uid = ? AND oc_user_traffic_statistics.created_at BETWEEN ? AND ?", uid, start, end).
+		Select("oc_user_traffic_statistics.created_at, oc_user_traffic_statistics.rx, oc_user_traffic_statistics.tx").
+		Order("oc_user_traffic_statistics.created_at")
+	return eachRow(query, fn)
+}
+
+// ExportActivities call fn for every activity of the ocserv user between start and end
+func (o *OcservUserRepository) ExportActivities(c context.Context, uid string, start, end time.Time,
+	fn func(activity *models.OcUserActivity) error,
+) error {
+	query := ownedOcUsers(c, o.db.WithContext(c)).
+		Table("oc_user_activities").
+		Joins("JOIN oc_users ON oc_users.id = oc_user_activities.oc_user_id").
+		Where("oc_users.uid = ? AND oc_user_activities.created_at BETWEEN ? AND ?", uid, start, end).
+		Select("oc_user_activities.*").
+		Order("oc_user_activities.created_at")
+	return eachRow(query, fn)
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/utils/tests"
+	"testing"
+	"time"
+)
+
+func filterSQL(t *testing.T, filter OcUserFilter, online []string) string {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+	now := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	tx, err := filter.apply(db.Table("oc_users"), now, online)
+	assert.NoError(t, err)
+	stmt := tx.Select("uid").Find(&[]string{}).Statement
+	return stmt.SQL.String()
+}
+
+func TestOcUserFilterApply(t *testing.T) {
+	locked, online, usage := true, false, 80
+	sql := filterSQL(t, OcUserFilter{
+		Username:     "a_b",
+		Group:        "defaults",
+		IsLocked:     &locked,
+		IsOnline:     &online,
+		ExpireWithin: 7,
+		UsageAbove:   &usage,
+	}, []string{"user1"})
+	for _, condition := range []string{
+		"oc_users.username ILIKE ?",
+		`oc_users."group" = ?`,
+		"oc_users.is_locked = ?",
+		"oc_users.username NOT IN (?)",
+		"oc_users.expire_at >= ? AND oc_users.expire_at < ?",
+		"oc_users.traffic_type <> ? AND oc_users.traffic_size > 0",
+	} {
+		assert.Contains(t, sql, condition)
+	}
+
+	online = true
+	assert.Contains(t, filterSQL(t, OcUserFilter{IsOnline: &online}, nil), "1 = 0")
+	online = false
+	assert.NotContains(t, filterSQL(t, OcUserFilter{IsOnline: &online}, nil), "WHERE")
+
+	_, err := (&OcUserFilter{ExpireBefore: "10/03/2025"}).apply(nil, time.Now(), nil)
+	assert.Error(t, err)
+}
+
+func TestLikeEscaper(t *testing.T) {
+	assert.Equal(t, `50\%\_off\\`, likeEscaper.Replace(`50%_off\`))
+}
+
+func TestOcUserOrder(t *testing.T) {
+	order, err := ocUserOrder(utils.RequestPagination{Order: "group", Sort: "ASC"})
+	assert.NoError(t, err)
+	assert.Equal(t, clause.OrderByColumn{Column: clause.Column{Table: "oc_users", Name: "group"}}, order)
+
+	order, err = ocUserOrder(utils.NewPaginationRequest())
+	assert.NoError(t, err)
+	assert.True(t, order.Desc)
+
+	_, err = ocUserOrder(utils.RequestPagination{Order: "id; DROP TABLE oc_users"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"api/pkg/ocpasswd"
+	"context"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"slices"
+	"strconv"
+)
+
+// DefaultGroup group of ocserv users that are not in a group
+const DefaultGroup = "defaults"
+
+// OcpasswdImportOptions traffic of imported ocserv users, ocpasswd does not know about traffic
+type OcpasswdImportOptions struct {
+	TrafficType string
+	TrafficSize int
+	DryRun      bool
+}
+
+// OcpasswdConflict entry of ocpasswd that is not imported
+type OcpasswdConflict struct {
+	Line     int    `json:"line"`
+	Username string `json:"username,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// OcpasswdImport usernames of the imported ocserv users and the entries that are not imported
+type OcpasswdImport struct {
+	DryRun    bool               `json:"dry_run"`
+	Created   []string           `json:"created"`
+	Conflicts []OcpasswdConflict `json:"conflicts"`
+}
+
+// ImportOcpasswd create the ocserv users of ocpasswd entries that are missing from the database.
+// Their passwords are hashed in ocpasswd, so they are imported without a password and keep the
+// one of ocpasswd until a new password is set. Entries of existing usernames or of groups other
+// than the default that are not in groups are conflicts. All users are created together.
+func (o *OcservUserRepository) ImportOcpasswd(c context.Context, entries []ocpasswd.Entry, invalid []ocpasswd.LineError,
+	groups []string, options *OcpasswdImportOptions,
+) (*OcpasswdImport, error) {
+	report := &OcpasswdImport{DryRun: options.DryRun, Created: []string{}, Conflicts: []OcpasswdConflict{}}
+	for _, line := range invalid {
+		report.Conflicts = append(report.Conflicts, OcpasswdConflict{Line: line.Line, Reason: line.Reason})
+	}
+	usernames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		usernames = append(usernames, entry.Username)
+	}
+	existing, err := o.ExistingUsernames(c, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.OcUser
+	seen := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		group := entry.Group
+		if group == "" || group == ocpasswd.NoGroup {
+			group = DefaultGroup
+		}
+		conflict := OcpasswdConflict{Line: entry.Line, Username: entry.Username}
+		switch {
+		case slices.Contains(existing, entry.Username):
+			conflict.Reason = "ocserv user already exists"
+		case seen[entry.Username] != 0:
+			conflict.Reason = fmt.Sprintf("username is duplicate of line %d", seen[entry.Username])
+		case group != DefaultGroup && !slices.Contains(groups, group):
+			conflict.Reason = fmt.Sprintf("group %s does not exist", group)
+		default:
+			seen[entry.Username] = entry.Line
+			users = append(users, models.OcUser{
+				Username:    entry.Username,
+				Group:       group,
+				IsLocked:    entry.Locked,
+				TrafficType: options.TrafficType,
+				TrafficSize: options.TrafficSize,
+			})
+			report.Created = append(report.Created, entry.Username)
+			continue
+		}
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+	if options.DryRun || len(users) == 0 {
+		return report, nil
+	}
+
+	actor, _ := c.Value("userID").(string)
+	userID, ownerErr := strconv.Atoi(actor)
+	err = o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		for i := range users {
+			if err := tx.Table("oc_users").Create(&users[i]).Error; err != nil {
+				return fmt.Errorf("ocserv user %s: %w", users[i].Username, err)
+			}
+			if ownerErr == nil {
+				if err := tx.Create(&entities.OcUserOwner{OcUserID: users[i].ID, UserID: uint(userID)}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	o.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "import_ocpasswd",
+		ModelName: "oc_user",
+		ModelUID:  "ocpasswd",
+		UserUID:   actorUID(c),
+		NewState:  report,
+	})
+	return report, nil
+}
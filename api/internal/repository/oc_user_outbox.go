@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/config"
+	"api/pkg/event"
+	"api/pkg/ocpasswd"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/handler/occtl"
+	"github.com/mmtaee/go-oc-utils/handler/ocuser"
+	"github.com/mmtaee/go-oc-utils/logger"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Kinds of ocserv user operations
+const (
+	OperationCreate     = "create"
+	OperationUpdate     = "update"
+	OperationLock       = "lock"
+	OperationUnlock     = "unlock"
+	OperationDelete     = "delete"
+	OperationDisconnect = "disconnect"
+)
+
+// Statuses of ocserv user operations
+const (
+	OperationPending = "pending"
+	OperationRunning = "running"
+	OperationFailed  = "failed"
+	OperationDone    = "done"
+)
+
+const (
+	maxOperationAttempts = 6
+	// operationLease running operations of an api that stopped are applied again after it
+	operationLease      = time.Minute
+	operationBackoff    = 30 * time.Second
+	maxOperationBackoff = 30 * time.Minute
+	operationRetention  = 7 * 24 * time.Hour
+)
+
+type OcUserOutboxRepository struct {
+	db           *gorm.DB
+	ocUser       ocuser.OcservUserInterface
+	occtl        occtl.OcInterface
+	ocpasswdFile string
+	WorkerEvent  *event.WorkerEvent
+}
+
+type OcUserOutboxRepositoryInterface interface {
+	Operations(c context.Context, status string) (*[]entities.OcUserOperation, error)
+	Retry(c context.Context, id uint) (*entities.OcUserOperation, error)
+}
+
+func NewOcUserOutboxRepository() *OcUserOutboxRepository {
+	return &OcUserOutboxRepository{
+		db:           database.Connection(),
+		ocUser:       ocuser.NewOcservUser(),
+		occtl:        occtl.NewOcctl(),
+		ocpasswdFile: config.GetApp().OcpasswdFile,
+		WorkerEvent:  event.GetWorker(),
+	}
+}
+
+// enqueueOperation write an operation of kind for the ocserv user in tx, so it is committed or
+// rolled back with the change of the user
+func enqueueOperation(tx *gorm.DB, kind string, user *models.OcUser) (entities.OcUserOperation, error) {
+	op := entities.OcUserOperation{
+		Kind:      kind,
+		Username:  user.Username,
+		OcUserUID: user.UID,
+		Status:    OperationPending,
+		NextRunAt: time.Now(),
+	}
+	err := tx.Create(&op).Error
+	return op, err
+}
+
+// operationDelay wait time before the next attempt of an operation that failed attempts times
+func operationDelay(attempts int) time.Duration {
+	delay := operationBackoff
+	for i := 1; i < attempts && delay < maxOperationBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxOperationBackoff)
+}
+
+// Apply apply committed operations in order. Failed operations stay in the outbox and are
+// retried by Process, so their errors are only logged.
+func (o *OcUserOutboxRepository) Apply(c context.Context, ops []entities.OcUserOperation) {
+	for _, op := range ops {
+		if err := o.apply(c, op.ID); err != nil {
+			logger.Logf(logger.WARNING, "ocserv user %s operation %s failed: %v", op.Username, op.Kind, err)
+		}
+	}
+}
+
+// Process apply the due operations in the order they were written and delete done operations
+// older than operationRetention. It returns the number of operations that were attempted.
+func (o *OcUserOutboxRepository) Process(c context.Context, limit int) (int, error) {
+	var ids []uint
+	now := time.Now()
+	err := o.db.WithContext(c).Model(&entities.OcUserOperation{}).
+		Where("status IN ? AND next_run_at <= ?", []string{OperationPending, OperationRunning}, now).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err = o.apply(c, id); err != nil {
+			logger.Logf(logger.WARNING, "ocserv user operation %d failed: %v", id, err)
+		}
+	}
+	err = o.db.WithContext(c).
+		Where("status = ? AND applied_at < ?", OperationDone, now.Add(-operationRetention)).
+		Delete(&entities.OcUserOperation{}).Error
+	return len(ids), err
+}
+
+// apply run the operation of id when it is due and no one else runs it, and record the outcome
+func (o *OcUserOutboxRepository) apply(c context.Context, id uint) error {
+	// the outcome is recorded even when the request of c is gone
+	db := o.db.WithContext(context.WithoutCancel(c))
+	now := time.Now()
+	claim := db.Model(&entities.OcUserOperation{}).
+		Where("id = ? AND status IN ? AND next_run_at <= ?", id, []string{OperationPending, OperationRunning}, now).
+		Updates(map[string]interface{}{
+			"status":      OperationRunning,
+			"attempts":    gorm.Expr("attempts + 1"),
+			"next_run_at": now.Add(operationLease),
+		})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return claim.Error
+	}
+	var op entities.OcUserOperation
+	if err := db.First(&op, id).Error; err != nil {
+		return err
+	}
+
+	runErr := o.run(c, &op)
+	now = time.Now()
+	updates := map[string]interface{}{"status": OperationDone, "last_error": "", "applied_at": now}
+	if runErr != nil {
+		updates = map[string]interface{}{
+			"status":      OperationPending,
+			"last_error":  runErr.Error(),
+			"next_run_at": now.Add(operationDelay(op.Attempts)),
+		}
+		if op.Attempts >= maxOperationAttempts {
+			updates["status"] = OperationFailed
+		}
+	}
+	if err := db.Model(&op).Updates(updates).Error; err != nil {
+		return err
+	}
+	return runErr
+}
+
+// run apply op. Operations are idempotent, so running one again after a crash is safe: ocpasswd
+// operations write the current state of the ocserv user in the database to its entry, and a
+// disconnect only fails while the user is still connected.
+func (o *OcUserOutboxRepository) run(c context.Context, op *entities.OcUserOperation) error {
+	if op.Kind == OperationDisconnect {
+		err := o.occtl.Disconnect(c, op.Username)
+		if err != nil {
+			if _, showErr := o.occtl.ShowUser(c, op.Username); showErr != nil {
+				return nil
+			}
+		}
+		return err
+	}
+	return o.writeOcpasswd(c, op)
+}
+
+// writeOcpasswd make the ocpasswd entry of the operation username match its ocserv user. The
+// entry is deleted when the user does not exist, and password and group are only written by
+// create and update operations or when the entry is missing.
+func (o *OcUserOutboxRepository) writeOcpasswd(c context.Context, op *entities.OcUserOperation) error {
+	entries, _, err := ocpasswd.Read(o.ocpasswdFile)
+	if err != nil {
+		return err
+	}
+	var entry *ocpasswd.Entry
+	for i := range entries {
+		if entries[i].Username == op.Username {
+			entry = &entries[i]
+			break
+		}
+	}
+
+	var user models.OcUser
+	err = o.db.WithContext(c).Table("oc_users").Where("username = ?", op.Username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if entry == nil {
+			return nil
+		}
+		return o.ocUser.Delete(c, op.Username)
+	} else if err != nil {
+		return err
+	}
+
+	rewrite := entry == nil || op.Kind == OperationCreate || op.Kind == OperationUpdate
+	if rewrite {
+		switch {
+		case user.Password == "" && entry == nil:
+			return errUnknownPassword
+		case user.Password == "":
+			// users imported from ocpasswd keep their entry until a password is set
+			rewrite = false
+		case entry == nil:
+			err = o.ocUser.Create(c, user.Username, user.Password, user.Group)
+		default:
+			err = o.ocUser.Update(c, user.Username, user.Password, user.Group)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// a rewritten entry has a new hash, so it is not locked anymore
+	if rewrite || entry.Locked != user.IsLocked {
+		return writeLockState(c, o.ocUser, &user)
+	}
+	return nil
+}
+
+// Operations ocserv user operations of status, or the operations that are not done when status
+// is empty
+func (o *OcUserOutboxRepository) Operations(c context.Context, status string) (*[]entities.OcUserOperation, error) {
+	var ops []entities.OcUserOperation
+	query := o.db.WithContext(c).Order("id")
+	if status == "" {
+		query = query.Where("status IN ?", []string{OperationPending, OperationRunning, OperationFailed})
+	} else {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&ops).Error; err != nil {
+		return nil, err
+	}
+	return &ops, nil
+}
+
+// Retry apply a failed or pending operation again now with all of its attempts
+func (o *OcUserOutboxRepository) Retry(c context.Context, id uint) (*entities.OcUserOperation, error) {
+	var op entities.OcUserOperation
+	if err := o.db.WithContext(c).First(&op, id).Error; err != nil {
+		return nil, err
+	}
+	if op.Status != OperationFailed && op.Status != OperationPending {
+		return nil, fmt.Errorf("operation is %s, only pending and failed operations are retried", op.Status)
+	}
+	err := o.db.WithContext(c).Model(&op).
+		Where("status IN ?", []string{OperationPending, OperationFailed}).
+		Updates(map[string]interface{}{"status": OperationPending, "attempts": 0, "next_run_at": time.Now()}).Error
+	if err != nil {
+		return nil, err
+	}
+	if err = o.apply(c, op.ID); err != nil {
+		logger.Logf(logger.WARNING, "ocserv user %s operation %s failed: %v", op.Username, op.Kind, err)
+	}
+	if err = o.db.WithContext(c).First(&op, id).Error; err != nil {
+		return nil, err
+	}
+	o.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "retry_oc_user_operation",
+		ModelName: "oc_user",
+		ModelUID:  op.OcUserUID,
+		UserUID:   actorUID(c),
+		NewState:  op,
+	})
+	return &op, nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"context"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/handler/occtl"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// fakeOcctl occtl of a user that is connected while online is set, disconnects fail
+type fakeOcctl struct {
+	occtl.OcInterface
+	online bool
+}
+
+func (f *fakeOcctl) Disconnect(context.Context, string) error {
+	return errors.New("occtl failed")
+}
+
+func (f *fakeOcctl) ShowUser(_ context.Context, username string) (*[]occtl.OcUser, error) {
+	if !f.online {
+		return nil, errors.New("user not found")
+	}
+	return &[]occtl.OcUser{{Username: username}}, nil
+}
+
+func TestOperationDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, operationDelay(1))
+	assert.Equal(t, time.Minute, operationDelay(2))
+	assert.Equal(t, 8*time.Minute, operationDelay(5))
+	assert.Equal(t, maxOperationBackoff, operationDelay(20))
+}
+
+func TestRunDisconnect(t *testing.T) {
+	op := &entities.OcUserOperation{Kind: OperationDisconnect, Username: "alice"}
+
+	o := &OcUserOutboxRepository{occtl: &fakeOcctl{online: true}}
+	assert.EqualError(t, o.run(context.Background(), op), "occtl failed")
+
+	// a user that is not connected anymore is disconnected
+	o = &OcUserOutboxRepository{occtl: &fakeOcctl{}}
+	assert.NoError(t, o.run(context.Background(), op))
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/config"
+	"api/pkg/event"
+	"api/pkg/sso"
+	"api/pkg/tokencache"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/models"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// oidcLoginLifetime is the time to finish the login at the identity provider
+const oidcLoginLifetime = 10 * time.Minute
+
+var (
+	errUnknownProvider  = errors.New("unknown single sign-on provider")
+	errInvalidOIDCState = errors.New("invalid or expired single sign-on state")
+)
+
+type OIDCRepository struct {
+	db          *gorm.DB
+	providers   map[string]*sso.Provider
+	names       []string
+	WorkerEvent *event.WorkerEvent
+}
+
+type OIDCRepositoryInterface interface {
+	Providers() []string
+	Begin(c context.Context, provider string) (string, error)
+	Finish(c context.Context, provider, state, code string) (*models.User, error)
+}
+
+func NewOIDCRepository() *OIDCRepository {
+	repo := &OIDCRepository{
+		db:          database.Connection(),
+		providers:   make(map[string]*sso.Provider),
+		WorkerEvent: event.GetWorker(),
+	}
+	for _, cfg := range config.GetOIDC() {
+		repo.providers[cfg.Name] = sso.New(&cfg)
+		repo.names = append(repo.names, cfg.Name)
+	}
+	return repo
+}
+
+// Providers names of the configured providers
+func (o *OIDCRepository) Providers() []string {
+	return o.names
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Begin create state, nonce and PKCE verifier of a login and return the authorization url of provider
+func (o *OIDCRepository) Begin(c context.Context, provider string) (string, error) {
+	p, ok := o.providers[provider]
+	if !ok {
+		return "", errUnknownProvider
+	}
+	state, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	login := entities.OIDCLogin{
+		State:    state,
+		Provider: provider,
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    nonce,
+		ExpireAt: time.Now().Add(oidcLoginLifetime),
+	}
+	authURL, err := p.AuthURL(c, login.State, login.Verifier, login.Nonce)
+	if err != nil {
+		return "", err
+	}
+	err = o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expire_at < ?", time.Now()).Delete(&entities.OIDCLogin{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&login).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// takeLogin delete and return the pending login of state so a callback is accepted once
+func (o *OIDCRepository) takeLogin(c context.Context, provider, state string) (*entities.OIDCLogin, error) {
+	var login entities.OIDCLogin
+	err := o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state = ? AND provider = ?", state, provider).
+			First(&login).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidOIDCState
+			}
+			return err
+		}
+		return tx.Delete(&login).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(login.ExpireAt) {
+		return nil, errInvalidOIDCState
+	}
+	return &login, nil
+}
+
+// Finish exchange the code of a pending login, then create or update the staff user linked to
+// the provider subject with admin status and permissions of its groups claim
+func (o *OIDCRepository) Finish(c context.Context, provider, state, code string) (*models.User, error) {
+	p, ok := o.providers[provider]
+	if !ok {
+		return nil, errUnknownProvider
+	}
+	login, err := o.takeLogin(c, provider, state)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := p.Exchange(c, code, login.Verifier, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	isAdmin, permission := p.Config().Permission(identity.Groups)
+
+	var (
+		user    *models.User
+		created bool
+	)
+	err = o.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var link entities.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&link).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			var count int64
+			if err = tx.Model(&models.User{}).Where("username = ?", identity.Username).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errLocalUserExists
+			}
+			created = true
+			if user, err = createExternalUser(tx, identity.Username, isAdmin, permission); err != nil {
+				return err
+			}
+			return tx.Create(&entities.UserIdentity{
+				UserID:   user.ID,
+				Provider: provider,
+				Subject:  identity.Subject,
+				Email:    identity.Email,
+				SyncedAt: time.Now(),
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		user = &models.User{}
+		if err = tx.First(user, link.UserID).Error; err != nil {
+			return err
+		}
+		if err = syncExternalUser(tx, user, isAdmin, permission); err != nil {
+			return err
+		}
+		return tx.Model(&link).Updates(map[string]interface{}{"email": identity.Email, "synced_at": time.Now()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		o.WorkerEvent.AddEvent(&event.SchemaEvent{
+			ModelName: "user",
+			EventType: "create_staff",
+			ModelUID:  user.UID,
+			UserUID:   event.SystemUserUID,
+			NewState:  user,
+		})
+	} else {
+		// permissions of cached tokens must follow the provider groups
+		tokencache.Default().Invalidate(user.ID)
+	}
+	return user, nil
+}
@@ -1,8 +1,12 @@
 package repository
 
 import (
+	"api/internal/entities"
+	"api/pkg/captcha"
 	"api/pkg/event"
+	"api/pkg/utils"
 	"context"
+	"errors"
 	"github.com/mmtaee/go-oc-utils/database"
 	"github.com/mmtaee/go-oc-utils/models"
 	"gorm.io/gorm"
@@ -16,8 +20,11 @@ type PanelConfigRepository struct {
 
 type PanelConfigRepositoryInterface interface {
 	CreateConfig(c context.Context, config models.PanelConfig) error
-	UpdateConfig(c context.Context, siteKey, secretKet string) error
+	UpdateConfig(c context.Context, siteKey, secretKet *string) error
 	GetConfig(c context.Context) (*models.PanelConfig, error)
+	GetSettings(c context.Context) (*entities.PanelSetting, error)
+	UpdateSettings(c context.Context, settings *entities.PanelSetting) error
+	PasswordPolicy(c context.Context) (*utils.PasswordPolicy, error)
 }
 
 func NewPanelConfigRepository() PanelConfigRepositoryInterface {
@@ -31,14 +38,19 @@ func (p *PanelConfigRepository) CreateConfig(c context.Context, config models.Pa
 	return p.db.WithContext(c).Create(&config).Error
 }
 
-func (p *PanelConfigRepository) UpdateConfig(c context.Context, siteKey, secretKet string) error {
+// UpdateConfig update the captcha keys that are not nil
+func (p *PanelConfigRepository) UpdateConfig(c context.Context, siteKey, secretKet *string) error {
 	config := &models.PanelConfig{}
 	return p.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&config).Error; err != nil {
 			return err
 		}
-		config.GoogleCaptchaSiteKey = siteKey
-		config.GoogleCaptchaSecretKey = secretKet
+		if siteKey != nil {
+			config.GoogleCaptchaSiteKey = *siteKey
+		}
+		if secretKet != nil {
+			config.GoogleCaptchaSecretKey = *secretKet
+		}
 		err := tx.WithContext(c).Save(&config).Error
 		if err != nil {
 			return err
@@ -60,3 +72,61 @@ func (p *PanelConfigRepository) GetConfig(c context.Context) (*models.PanelConfi
 	}
 	return config, nil
 }
+
+// GetSettings return panel settings or default settings when they are not saved yet
+func (p *PanelConfigRepository) GetSettings(c context.Context) (*entities.PanelSetting, error) {
+	settings := &entities.PanelSetting{
+		CaptchaProvider:   captcha.ReCaptcha,
+		LoginMaxFailures:  5,
+		LoginLockout:      15,
+		PasswordMinLength: 8,
+		PasswordHistory:   3,
+	}
+	err := p.db.WithContext(c).First(settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (p *PanelConfigRepository) UpdateSettings(c context.Context, settings *entities.PanelSetting) error {
+	return p.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		old := entities.PanelSetting{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&old).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		settings.ID = old.ID
+		if err = tx.Save(settings).Error; err != nil {
+			return err
+		}
+		p.WorkerEvent.AddEvent(&event.SchemaEvent{
+			EventType: "update_panel_settings",
+			ModelName: "panel_setting",
+			UserUID:   actorUID(c),
+			OldState:  old,
+			NewState:  settings,
+		})
+		return nil
+	})
+}
+
+// PasswordPolicy return password policy of panel settings
+func (p *PanelConfigRepository) PasswordPolicy(c context.Context) (*utils.PasswordPolicy, error) {
+	settings, err := p.GetSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	return &utils.PasswordPolicy{
+		MinLength:     settings.PasswordMinLength,
+		RequireUpper:  settings.PasswordUpper,
+		RequireLower:  settings.PasswordLower,
+		RequireDigit:  settings.PasswordDigit,
+		RequireSymbol: settings.PasswordSymbol,
+		Denylist:      utils.ParseDenylist(settings.PasswordDenylist),
+		History:       settings.PasswordHistory,
+	}, nil
+}
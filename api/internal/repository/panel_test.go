@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+	"testing"
+)
+
+func TestPanelSettingCreateKeepsZeroValues(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+	settings := entities.PanelSetting{CaptchaProvider: "recaptcha", LoginMaxFailures: 5, PasswordHistory: 0}
+	assert.NoError(t, db.Create(&settings).Error)
+	assert.Equal(t, 0, settings.PasswordHistory)
+	assert.Equal(t, 5, settings.LoginMaxFailures)
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/utils"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+)
+
+// checkPasswordHistory return an error when password is the current or one of the last history passwords of user
+func checkPasswordHistory(tx *gorm.DB, user *models.User, password string, history int) error {
+	if history <= 0 {
+		return nil
+	}
+	err := fmt.Errorf("password must not be one of the last %d passwords", history)
+	if utils.Check(password, user.Password, user.Salt) {
+		return err
+	}
+	var previous []entities.UserPasswordHistory
+	if dbErr := tx.Where("user_id = ?", user.ID).Order("id DESC").Limit(history).Find(&previous).Error; dbErr != nil {
+		return dbErr
+	}
+	for _, item := range previous {
+		if utils.Check(password, item.Password, item.Salt) {
+			return err
+		}
+	}
+	return nil
+}
+
+// savePasswordHistory add the new password hash of user to history and keep only the last history hashes
+func savePasswordHistory(tx *gorm.DB, user *models.User, history int) error {
+	if history <= 0 {
+		return tx.Where("user_id = ?", user.ID).Delete(&entities.UserPasswordHistory{}).Error
+	}
+	err := tx.Create(&entities.UserPasswordHistory{
+		UserID:   user.ID,
+		Password: user.Password,
+		Salt:     user.Salt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	keep := tx.Model(&entities.UserPasswordHistory{}).Select("id").
+		Where("user_id = ?", user.ID).Order("id DESC").Limit(history)
+	return tx.Where("user_id = ? AND id NOT IN (?)", user.ID, keep).Delete(&entities.UserPasswordHistory{}).Error
+}
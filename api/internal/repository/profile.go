@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"api/pkg/rbac"
+	"context"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+// Me current user with effective permissions and actions, expiry of the current session and two factor status
+type Me struct {
+	UID              string                `json:"uid"`
+	Username         string                `json:"username"`
+	IsAdmin          bool                  `json:"is_admin"`
+	Permission       models.UserPermission `json:"permission"`
+	Actions          []string              `json:"actions"`
+	SessionExpireAt  *time.Time            `json:"session_expire_at"`
+	TwoFactorEnabled bool                  `json:"two_factor_enabled"`
+	Profile          entities.UserProfile  `json:"profile"`
+}
+
+// ProfileUpdate profile fields to update, nil fields are not changed
+type ProfileUpdate struct {
+	DisplayName *string
+	Email       *string
+	Language    *string
+}
+
+// adminPermission effective permission of admins that pass every permission check
+var adminPermission = models.UserPermission{OcUser: true, OcGroup: true, Statistic: true, Occtl: true, System: true}
+
+func profile(tx *gorm.DB, userID uint) (entities.UserProfile, error) {
+	profile := entities.UserProfile{UserID: userID}
+	err := tx.Where("user_id = ?", userID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return profile, nil
+	}
+	return profile, err
+}
+
+// Me return the user of the request token
+func (r *UserRepository) Me(c context.Context) (*Me, error) {
+	userID, err := strconv.Atoi(c.Value("userID").(string))
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err = r.db.WithContext(c).Preload("Permission").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	me := &Me{
+		UID:        user.UID,
+		Username:   user.Username,
+		IsAdmin:    user.IsAdmin,
+		Permission: user.Permission,
+	}
+	if user.IsAdmin {
+		me.Permission = adminPermission
+		for _, action := range rbac.Actions {
+			me.Actions = append(me.Actions, string(action))
+		}
+	} else if me.Actions, err = UserActions(r.db.WithContext(c), user.ID); err != nil {
+		return nil, err
+	}
+
+	var token models.UserToken
+	err = r.db.WithContext(c).Select("expire_at").Where("token = ?", c.Value("token")).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	me.SessionExpireAt = token.ExpireAt
+
+	twoFactor, err := r.TwoFactor.Get(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	me.TwoFactorEnabled = twoFactor != nil && twoFactor.Enabled
+
+	if me.Profile, err = profile(r.db.WithContext(c), user.ID); err != nil {
+		return nil, err
+	}
+	return me, nil
+}
+
+// UpdateProfile update profile fields of the request user
+func (r *UserRepository) UpdateProfile(c context.Context, update *ProfileUpdate) (*entities.UserProfile, error) {
+	userID, err := strconv.Atoi(c.Value("userID").(string))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		user                   models.User
+		oldProfile, newProfile entities.UserProfile
+	)
+	err = r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", "uid").First(&user, userID).Error; err != nil {
+			return err
+		}
+		var err error
+		if oldProfile, err = profile(tx, user.ID); err != nil {
+			return err
+		}
+		newProfile = oldProfile
+		if update.DisplayName != nil {
+			newProfile.DisplayName = *update.DisplayName
+		}
+		if update.Email != nil {
+			newProfile.Email = *update.Email
+		}
+		if update.Language != nil {
+			newProfile.Language = *update.Language
+		}
+		return tx.Save(&newProfile).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.WorkerEvent.AddEvent(&event.SchemaEvent{
+		ModelName: "user",
+		EventType: "update_profile",
+		ModelUID:  user.UID,
+		UserUID:   actorUID(c),
+		OldState:  oldProfile,
+		NewState:  newProfile,
+	})
+	return &newProfile, nil
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"slices"
+	"time"
+)
+
+// ErrQuotaExceeded ocserv user is out of the quota of its staff
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+type QuotaRepository struct {
+	db          *gorm.DB
+	WorkerEvent *event.WorkerEvent
+}
+
+type QuotaRepositoryInterface interface {
+	Quota(c context.Context, userUID string) (*Quota, error)
+	SetQuota(c context.Context, userUID string, limits *entities.StaffQuota) (*Quota, error)
+}
+
+// QuotaUsage ocserv users of a staff and the traffic allocated to them in GB
+type QuotaUsage struct {
+	Users   int64 `json:"users"`
+	Traffic int64 `json:"traffic"`
+}
+
+// Quota limits of a staff with the current usage
+type Quota struct {
+	Limits entities.StaffQuota `json:"limits"`
+	Usage  QuotaUsage          `json:"usage"`
+}
+
+func NewQuotaRepository() *QuotaRepository {
+	return &QuotaRepository{
+		db:          database.Connection(),
+		WorkerEvent: event.GetWorker(),
+	}
+}
+
+// quotaUsage usage of the ocserv users owned by userID except exceptID
+func quotaUsage(tx *gorm.DB, userID, exceptID uint) (QuotaUsage, error) {
+	var usage QuotaUsage
+	err := tx.Table("oc_users").
+		Joins("JOIN oc_user_owners ON oc_user_owners.oc_user_id = oc_users.id").
+		Where("oc_user_owners.user_id = ? AND oc_users.id <> ?", userID, exceptID).
+		Select("COUNT(*) AS users, COALESCE(SUM(CASE WHEN oc_users.traffic_type = ? THEN 0 ELSE oc_users.traffic_size END), 0) AS traffic", models.Free).
+		Scan(&usage).Error
+	return usage, err
+}
+
+// checkQuota check the created or updated ocserv user against quota. Limits of an update are
+// only checked for the fields that change, so staff can still edit users set up by admins.
+func checkQuota(quota *entities.StaffQuota, usage QuotaUsage, user, existing *models.OcUser, now time.Time) error {
+	if quota.MaxUsers != nil && existing == nil && usage.Users+1 > int64(*quota.MaxUsers) {
+		return fmt.Errorf("%w: at most %d ocserv users", ErrQuotaExceeded, *quota.MaxUsers)
+	}
+	if quota.MaxTraffic != nil &&
+		(existing == nil || user.TrafficType != existing.TrafficType || user.TrafficSize > existing.TrafficSize) {
+		if user.TrafficType == models.Free {
+			return fmt.Errorf("%w: ocserv users must have a traffic limit", ErrQuotaExceeded)
+		}
+		if usage.Traffic+int64(user.TrafficSize) > int64(*quota.MaxTraffic) {
+			return fmt.Errorf("%w: at most %d GB traffic in total", ErrQuotaExceeded, *quota.MaxTraffic)
+		}
+	}
+	if quota.MaxExpireDays != nil && (existing == nil || !sameTime(user.ExpireAt, existing.ExpireAt)) {
+		horizon := now.AddDate(0, 0, *quota.MaxExpireDays)
+		if user.ExpireAt == nil || user.ExpireAt.After(horizon) {
+			return fmt.Errorf("%w: ocserv users must expire within %d days", ErrQuotaExceeded, *quota.MaxExpireDays)
+		}
+	}
+	if len(quota.Groups) > 0 && (existing == nil || user.Group != existing.Group) &&
+		!slices.Contains(quota.Groups, user.Group) {
+		return fmt.Errorf("%w: group %s is not allowed", ErrQuotaExceeded, user.Group)
+	}
+	return nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// enforceQuota check the ocserv user against the quota of the staff of the request. The quota
+// is locked until tx ends so concurrent requests of a staff can not exceed it. Admins have no quota.
+func enforceQuota(c context.Context, tx *gorm.DB, user, existing *models.OcUser) error {
+	owner := ownerID(c)
+	if owner == 0 {
+		return nil
+	}
+	var quota entities.StaffQuota
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", owner).First(&quota).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var exceptID uint
+	if existing != nil {
+		exceptID = existing.ID
+	}
+	usage, err := quotaUsage(tx, owner, exceptID)
+	if err != nil {
+		return err
+	}
+	return checkQuota(&quota, usage, user, existing, time.Now())
+}
+
+func staffQuota(tx *gorm.DB, userID uint) (*Quota, error) {
+	quota := Quota{Limits: entities.StaffQuota{UserID: userID, Groups: []string{}}}
+	err := tx.Where("user_id = ?", userID).First(&quota.Limits).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if quota.Usage, err = quotaUsage(tx, userID, 0); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// Quota limits of a staff with the current usage
+func (q *QuotaRepository) Quota(c context.Context, userUID string) (*Quota, error) {
+	var user models.User
+	if err := q.db.WithContext(c).Select("id").Where("uid = ? AND is_admin = ?", userUID, false).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return staffQuota(q.db.WithContext(c), user.ID)
+}
+
+// SetQuota replace limits of a staff. Existing ocserv users over the new limits are kept.
+func (q *QuotaRepository) SetQuota(c context.Context, userUID string, limits *entities.StaffQuota) (*Quota, error) {
+	var (
+		user     models.User
+		oldQuota entities.StaffQuota
+		quota    *Quota
+	)
+	err := q.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Select("id", "uid").Where("uid = ? AND is_admin = ?", userUID, false).First(&user).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("user_id = ?", user.ID).First(&oldQuota).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		newQuota := oldQuota
+		newQuota.UserID = user.ID
+		newQuota.MaxUsers = limits.MaxUsers
+		newQuota.MaxTraffic = limits.MaxTraffic
+		newQuota.MaxExpireDays = limits.MaxExpireDays
+		newQuota.Groups = limits.Groups
+		if newQuota.Groups == nil {
+			newQuota.Groups = []string{}
+		}
+		if err = tx.Save(&newQuota).Error; err != nil {
+			return err
+		}
+		quota, err = staffQuota(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.WorkerEvent.AddEvent(&event.SchemaEvent{
+		ModelName: "user",
+		EventType: "update_staff_quota",
+		ModelUID:  user.UID,
+		UserUID:   actorUID(c),
+		OldState:  oldQuota,
+		NewState:  quota.Limits,
+	})
+	return quota, nil
+}
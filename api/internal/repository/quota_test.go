@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestCheckQuota(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expireAt := now.AddDate(0, 0, 30)
+	quota := &entities.StaffQuota{
+		MaxUsers:      intPtr(2),
+		MaxTraffic:    intPtr(100),
+		MaxExpireDays: intPtr(30),
+		Groups:        []string{"defaults"},
+	}
+	user := func(group, trafficType string, size int, expireAt *time.Time) *models.OcUser {
+		return &models.OcUser{Group: group, TrafficType: trafficType, TrafficSize: size, ExpireAt: expireAt}
+	}
+
+	assert.NoError(t, checkQuota(quota, QuotaUsage{Users: 1, Traffic: 40}, user("defaults", models.MonthlyTransmit, 60, &expireAt), nil, now))
+
+	cases := map[string]struct {
+		usage QuotaUsage
+		user  *models.OcUser
+		error string
+	}{
+		"users":   {QuotaUsage{Users: 2}, user("defaults", models.MonthlyTransmit, 1, &expireAt), "quota exceeded: at most 2 ocserv users"},
+		"traffic": {QuotaUsage{Traffic: 90}, user("defaults", models.MonthlyTransmit, 11, &expireAt), "quota exceeded: at most 100 GB traffic in total"},
+		"free":    {QuotaUsage{}, user("defaults", models.Free, 0, &expireAt), "quota exceeded: ocserv users must have a traffic limit"},
+		"expire":  {QuotaUsage{}, user("defaults", models.MonthlyTransmit, 1, nil), "quota exceeded: ocserv users must expire within 30 days"},
+		"group":   {QuotaUsage{}, user("premium", models.MonthlyTransmit, 1, &expireAt), "quota exceeded: group premium is not allowed"},
+	}
+	for name, tc := range cases {
+		err := checkQuota(quota, tc.usage, tc.user, nil, now)
+		assert.ErrorIs(t, err, ErrQuotaExceeded, name)
+		assert.EqualError(t, err, tc.error, name)
+	}
+}
+
+func TestCheckQuotaUpdate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expireAt := now.AddDate(1, 0, 0)
+	quota := &entities.StaffQuota{MaxUsers: intPtr(1), MaxTraffic: intPtr(10), MaxExpireDays: intPtr(30), Groups: []string{"defaults"}}
+	existing := &models.OcUser{Group: "premium", TrafficType: models.Free, ExpireAt: &expireAt}
+
+	// unchanged fields set by an admin are kept
+	updated := *existing
+	assert.NoError(t, checkQuota(quota, QuotaUsage{Users: 1}, &updated, existing, now))
+
+	updated.Group = "other"
+	assert.ErrorIs(t, checkQuota(quota, QuotaUsage{Users: 1}, &updated, existing, now), ErrQuotaExceeded)
+}
@@ -0,0 +1,363 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"api/pkg/rbac"
+	"api/pkg/tokencache"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errBuiltinRole = errors.New("built-in roles can not be changed")
+
+type RoleRepository struct {
+	db          *gorm.DB
+	WorkerEvent *event.WorkerEvent
+}
+
+type RoleRepositoryInterface interface {
+	Roles(c context.Context) (*[]entities.Role, error)
+	CreateRole(c context.Context, role *entities.Role) error
+	UpdateRole(c context.Context, id uint, role *entities.Role) (*entities.Role, error)
+	DeleteRole(c context.Context, id uint) error
+	StaffRoles(c context.Context, userUID string) (*[]entities.Role, error)
+	SetStaffRoles(c context.Context, userUID string, roleIDs []uint) (*[]entities.Role, error)
+}
+
+func NewRoleRepository() *RoleRepository {
+	return &RoleRepository{
+		db:          database.Connection(),
+		WorkerEvent: event.GetWorker(),
+	}
+}
+
+func checkRole(role *entities.Role) error {
+	for _, area := range rbac.Areas {
+		if role.Name == area {
+			return fmt.Errorf("role name %s is reserved", role.Name)
+		}
+	}
+	return checkActions(role.Actions)
+}
+
+func checkActions(actions []string) error {
+	if len(actions) == 0 {
+		return errors.New("role must have at least one action")
+	}
+	for _, action := range actions {
+		if !rbac.Valid(action) {
+			return fmt.Errorf("unknown action %s", action)
+		}
+	}
+	return nil
+}
+
+// ensureBuiltinRoles create the missing built-in roles and update actions of existing ones to
+// the actions of their area, then return them by area
+func ensureBuiltinRoles(tx *gorm.DB) (map[string]entities.Role, error) {
+	roles := make(map[string]entities.Role, len(rbac.Areas))
+	for _, area := range rbac.Areas {
+		role := entities.Role{
+			Name:        area,
+			Description: fmt.Sprintf("all %s actions, assigned with the %s permission", area, area),
+			Actions:     rbac.AreaActions(area),
+			Builtin:     true,
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"actions", "builtin"}),
+		}).Create(&role).Error
+		if err != nil {
+			return nil, err
+		}
+		if err = tx.Where("name = ?", area).First(&role).Error; err != nil {
+			return nil, err
+		}
+		roles[area] = role
+	}
+	return roles, nil
+}
+
+func builtinRoles(tx *gorm.DB) (map[string]entities.Role, error) {
+	var list []entities.Role
+	if err := tx.Where("builtin = ?", true).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	if len(list) != len(rbac.Areas) {
+		return ensureBuiltinRoles(tx)
+	}
+	roles := make(map[string]entities.Role, len(list))
+	for _, role := range list {
+		roles[role.Name] = role
+	}
+	return roles, nil
+}
+
+// syncFlagRoles assign the built-in roles of the permission flags and remove the others.
+// Custom roles of the user are kept.
+func syncFlagRoles(tx *gorm.DB, userID uint, permission models.UserPermission) error {
+	roles, err := builtinRoles(tx)
+	if err != nil {
+		return err
+	}
+	for _, area := range rbac.Areas {
+		roleID := roles[area].ID
+		if rbac.AreaGranted(permission, area) {
+			err = tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&entities.UserRole{UserID: userID, RoleID: roleID}).Error
+		} else {
+			err = tx.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&entities.UserRole{}).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateRoles create the built-in roles and assign them to staff users with the equivalent
+// permission flags. It is safe to run more than once, since flags follow role assignments.
+func MigrateRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := ensureBuiltinRoles(tx); err != nil {
+			return err
+		}
+		var permissions []models.UserPermission
+		if err := tx.Find(&permissions).Error; err != nil {
+			return err
+		}
+		for _, permission := range permissions {
+			if err := syncFlagRoles(tx, permission.UserID, permission); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UserActions return the actions of the roles of a user
+func UserActions(tx *gorm.DB, userID uint) ([]string, error) {
+	var roles []entities.Role
+	err := tx.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	actions := []string{}
+	for _, role := range roles {
+		for _, action := range role.Actions {
+			if !seen[action] {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+	}
+	return actions, nil
+}
+
+func roleUserIDs(tx *gorm.DB, roleID uint) ([]uint, error) {
+	var userIDs []uint
+	err := tx.Model(&entities.UserRole{}).Where("role_id = ?", roleID).Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+func (r *RoleRepository) Roles(c context.Context) (*[]entities.Role, error) {
+	var roles []entities.Role
+	if err := r.db.WithContext(c).Order("builtin DESC, name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return &roles, nil
+}
+
+func (r *RoleRepository) CreateRole(c context.Context, role *entities.Role) error {
+	if err := checkRole(role); err != nil {
+		return err
+	}
+	role.Builtin = false
+	if err := r.db.WithContext(c).Create(role).Error; err != nil {
+		return err
+	}
+	r.WorkerEvent.AddEvent(&event.SchemaEvent{
+		ModelName: "role",
+		EventType: "create_role",
+		ModelUID:  role.Name,
+		UserUID:   actorUID(c),
+		NewState:  role,
+	})
+	return nil
+}
+
+// UpdateRole update name, description and actions of a custom role. Staff with the role get
+// the new actions on their next request.
+func (r *RoleRepository) UpdateRole(c context.Context, id uint, update *entities.Role) (*entities.Role, error) {
+	if err := checkRole(update); err != nil {
+		return nil, err
+	}
+	var (
+		oldRole, role entities.Role
+		userIDs       []uint
+	)
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&oldRole, id).Error; err != nil {
+			return err
+		}
+		if oldRole.Builtin {
+			return errBuiltinRole
+		}
+		role = oldRole
+		role.Name = update.Name
+		role.Description = update.Description
+		role.Actions = update.Actions
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		var err error
+		userIDs, err = roleUserIDs(tx, role.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokencache.Default().Invalidate(userIDs...)
+	r.WorkerEvent.AddEvent(&event.SchemaEvent{
+		ModelName: "role",
+		EventType: "update_role",
+		ModelUID:  role.Name,
+		UserUID:   actorUID(c),
+		OldState:  oldRole,
+		NewState:  role,
+	})
+	return &role, nil
+}
+
+func (r *RoleRepository) DeleteRole(c context.Context, id uint) error {
+	var (
+		role    entities.Role
+		userIDs []uint
+	)
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&role, id).Error; err != nil {
+			return err
+		}
+		if role.Builtin {
+			return errBuiltinRole
+		}
+		var err error
+		if userIDs, err = roleUserIDs(tx, role.ID); err != nil {
+			return err
+		}
+		if err = tx.Where("role_id = ?", role.ID).Delete(&entities.UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(userIDs...)
+	r.WorkerEvent.AddEvent(&event.SchemaEvent{
+		ModelName: "role",
+		EventType: "delete_role",
+		ModelUID:  role.Name,
+		UserUID:   actorUID(c),
+		OldState:  role,
+	})
+	return nil
+}
+
+func staffRoles(tx *gorm.DB, userID uint) (*[]entities.Role, error) {
+	var roles []entities.Role
+	err := tx.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.builtin DESC, roles.name").
+		Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return &roles, nil
+}
+
+func (r *RoleRepository) StaffRoles(c context.Context, userUID string) (*[]entities.Role, error) {
+	var user models.User
+	if err := r.db.WithContext(c).Select("id").Where("uid = ? AND is_admin = ?", userUID, false).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return staffRoles(r.db.WithContext(c), user.ID)
+}
+
+// SetStaffRoles replace the roles of a staff user. Permission flags are updated to the
+// assigned built-in roles.
+func (r *RoleRepository) SetStaffRoles(c context.Context, userUID string, roleIDs []uint) (*[]entities.Role, error) {
+	var (
+		user  models.User
+		roles *[]entities.Role
+	)
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Select("id", "uid").Where("uid = ? AND is_admin = ?", userUID, false).First(&user).Error
+		if err != nil {
+			return err
+		}
+		var assigned []entities.Role
+		if len(roleIDs) > 0 {
+			if err = tx.Where("id IN ?", roleIDs).Find(&assigned).Error; err != nil {
+				return err
+			}
+		}
+		if len(assigned) != len(uniqueIDs(roleIDs)) {
+			return errors.New("unknown role")
+		}
+		if err = tx.Where("user_id = ?", user.ID).Delete(&entities.UserRole{}).Error; err != nil {
+			return err
+		}
+		var areas []string
+		for _, role := range assigned {
+			if err = tx.Create(&entities.UserRole{UserID: user.ID, RoleID: role.ID}).Error; err != nil {
+				return err
+			}
+			if role.Builtin {
+				areas = append(areas, role.Name)
+			}
+		}
+		permission := rbac.Permission(areas)
+		err = tx.Model(&models.UserPermission{}).Where("user_id = ?", user.ID).
+			Select("oc_user", "oc_group", "statistic", "occtl", "system").
+			Updates(&permission).Error
+		if err != nil {
+			return err
+		}
+		roles, err = staffRoles(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokencache.Default().Invalidate(user.ID)
+	names := make([]string, 0, len(*roles))
+	for _, role := range *roles {
+		names = append(names, role.Name)
+	}
+	r.WorkerEvent.AddEvent(&event.SchemaEvent{
+		ModelName: "user",
+		EventType: "update_staff_roles",
+		ModelUID:  user.UID,
+		UserUID:   actorUID(c),
+		NewState:  names,
+	})
+	return roles, nil
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/tokencache"
+	"context"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+type SessionRepositoryInterface interface {
+	Sessions(c context.Context, userID uint, currentToken string) (*[]Session, error)
+	Revoke(c context.Context, userID, sessionID uint) error
+	RevokeOthers(c context.Context, userID uint, currentToken string) error
+	StaffSessions(c context.Context, userUID string) (*[]Session, error)
+	RevokeStaff(c context.Context, userUID string, sessionID uint) error
+	RevokeStaffAll(c context.Context, userUID string) error
+}
+
+type Session struct {
+	ID         uint       `json:"id"`
+	CreatedAt  *time.Time `json:"created_at"`
+	ExpireAt   *time.Time `json:"expire_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
+}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{
+		db: database.Connection(),
+	}
+}
+
+// createSession save client details of token from "ip" and "userAgent" context values
+func createSession(c context.Context, tx *gorm.DB, token *models.UserToken) error {
+	ip, _ := c.Value("ip").(string)
+	userAgent, _ := c.Value("userAgent").(string)
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	return tx.Create(&entities.UserSession{
+		UserTokenID: token.ID,
+		UserID:      token.UserID,
+		IP:          ip,
+		UserAgent:   userAgent,
+	}).Error
+}
+
+// revokeTokens delete tokens and sessions of user matched by the extra condition.
+// Callers must invalidate the token cache of user after the transaction is committed.
+func revokeTokens(tx *gorm.DB, userID uint, query string, args ...interface{}) error {
+	tokens := tx.Model(&models.UserToken{}).Select("id").Where("user_id = ?", userID)
+	if query != "" {
+		tokens = tokens.Where(query, args...)
+	}
+	var ids []uint
+	if err := tokens.Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("user_token_id IN ?", ids).Delete(&entities.UserSession{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("id IN ?", ids).Delete(&models.UserToken{}).Error
+}
+
+// Sessions list active sessions of user
+func (s *SessionRepository) Sessions(c context.Context, userID uint, currentToken string) (*[]Session, error) {
+	var sessions []Session
+	err := s.db.WithContext(c).Table("user_tokens").
+		Select(
+			"user_tokens.id, user_tokens.expire_at, user_sessions.created_at, user_sessions.last_used_at, "+
+				"user_sessions.ip, user_sessions.user_agent, user_tokens.token = ? AS current",
+			currentToken,
+		).
+		Joins("LEFT JOIN user_sessions ON user_sessions.user_token_id = user_tokens.id").
+		Where("user_tokens.user_id = ? AND user_tokens.expire_at > ?", userID, time.Now()).
+		Order("user_sessions.last_used_at DESC NULLS LAST, user_tokens.id DESC").
+		Scan(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sessions, nil
+}
+
+func (s *SessionRepository) staffID(c context.Context, userUID string) (uint, error) {
+	var user models.User
+	if err := s.db.WithContext(c).Where("uid = ?", userUID).First(&user).Error; err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// Revoke delete a session of user
+func (s *SessionRepository) Revoke(c context.Context, userID, sessionID uint) error {
+	err := s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.UserToken{}).Where("id = ? AND user_id = ?", sessionID, userID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("session not found")
+		}
+		return revokeTokens(tx, userID, "id = ?", sessionID)
+	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(userID)
+	return nil
+}
+
+// RevokeOthers delete all sessions of user except the current one
+func (s *SessionRepository) RevokeOthers(c context.Context, userID uint, currentToken string) error {
+	err := s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		return revokeTokens(tx, userID, "token <> ?", currentToken)
+	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(userID)
+	return nil
+}
+
+// StaffSessions list active sessions of staff by uid
+func (s *SessionRepository) StaffSessions(c context.Context, userUID string) (*[]Session, error) {
+	userID, err := s.staffID(c, userUID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sessions(c, userID, "")
+}
+
+// RevokeStaff delete a session of staff by uid
+func (s *SessionRepository) RevokeStaff(c context.Context, userUID string, sessionID uint) error {
+	userID, err := s.staffID(c, userUID)
+	if err != nil {
+		return err
+	}
+	return s.Revoke(c, userID, sessionID)
+}
+
+// RevokeStaffAll delete all sessions of staff by uid
+func (s *SessionRepository) RevokeStaffAll(c context.Context, userUID string) error {
+	userID, err := s.staffID(c, userUID)
+	if err != nil {
+		return err
+	}
+	err = s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		return revokeTokens(tx, userID, "")
+	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(userID)
+	return nil
+}
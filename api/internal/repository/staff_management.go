@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"api/internal/entities"
 	"api/pkg/event"
+	"api/pkg/tokencache"
 	"api/pkg/utils"
 	"context"
 	"fmt"
@@ -10,10 +12,12 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"strconv"
+	"time"
 )
 
 type StaffRepository struct {
 	db          *gorm.DB
+	panel       PanelConfigRepositoryInterface
 	WorkerEvent *event.WorkerEvent
 }
 
@@ -22,13 +26,18 @@ type StaffRepositoryInterface interface {
 	Permission(c context.Context, userUID string) (*models.UserPermission, error)
 	CreateStaff(c context.Context, user *models.User, permission *models.UserPermission) error
 	UpdateStaffPermission(c context.Context, userUID string, permission *models.UserPermission) error
-	UpdateStaffPassword(c context.Context, userUID, password, salt string) error
+	UpdateStaffPassword(c context.Context, userUID, password string) error
 	DeleteStaff(c context.Context, userUID string) error
+	StaffStatus(c context.Context, userUID string) (*entities.UserStatus, error)
+	DisableStaff(c context.Context, userUID string) (*entities.UserStatus, error)
+	EnableStaff(c context.Context, userUID string) (*entities.UserStatus, error)
+	SetStaffExpiry(c context.Context, userUID string, expireAt *time.Time) (*entities.UserStatus, error)
 }
 
 func NewStaffRepository() *StaffRepository {
 	return &StaffRepository{
 		db:          database.Connection(),
+		panel:       NewPanelConfigRepository(),
 		WorkerEvent: event.GetWorker(),
 	}
 }
@@ -87,6 +96,16 @@ func (s *StaffRepository) CreateStaff(c context.Context, staff *models.User, per
 	if err != nil {
 		return err
 	}
+	if err = syncFlagRoles(s.db.WithContext(c), staff.ID, *permission); err != nil {
+		return err
+	}
+	policy, err := s.panel.PasswordPolicy(c)
+	if err != nil {
+		return err
+	}
+	if err = savePasswordHistory(s.db.WithContext(c), staff, policy.History); err != nil {
+		return err
+	}
 
 	s.WorkerEvent.AddEvent(&event.SchemaEvent{
 		ModelName: "user_permission",
@@ -98,14 +117,27 @@ func (s *StaffRepository) CreateStaff(c context.Context, staff *models.User, per
 }
 
 func (s *StaffRepository) UpdateStaffPermission(c context.Context, userUID string, permission *models.UserPermission) error {
+	var user models.User
 	err := s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
-		return s.db.Model(&models.UserPermission{}).
-			Where("user_id = (?)", s.db.Table("users").Select("id").Where("uid = ?", userUID)).
-			Updates(&permission).Error
+		if err := tx.Where("uid = ?", userUID).First(&user).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.UserPermission{}).
+			Where("user_id = ?", user.ID).
+			Updates(permission).Error
+		if err != nil {
+			return err
+		}
+		var updated models.UserPermission
+		if err = tx.Where("user_id = ?", user.ID).First(&updated).Error; err != nil {
+			return err
+		}
+		return syncFlagRoles(tx, user.ID, updated)
 	})
 	if err != nil {
 		return err
 	}
+	tokencache.Default().Invalidate(user.ID)
 	s.WorkerEvent.AddEvent(&event.SchemaEvent{
 		ModelName: "user_permission",
 		ModelUID:  strconv.Itoa(int(permission.ID)),
@@ -115,19 +147,40 @@ func (s *StaffRepository) UpdateStaffPermission(c context.Context, userUID strin
 	return nil
 }
 
-func (s *StaffRepository) UpdateStaffPassword(c context.Context, userUID, password, salt string) error {
-	return s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
-		var user models.User
+func (s *StaffRepository) UpdateStaffPassword(c context.Context, userUID, password string) error {
+	policy, err := s.panel.PasswordPolicy(c)
+	if err != nil {
+		return err
+	}
+	var user models.User
+	err = s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 			Where("uid = ?", userUID).
 			First(&user).Error; err != nil {
 			return err
 		}
-		user.Password = password
-		user.Salt = salt
+		external, err := isExternalUser(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if external {
+			return errExternalManaged
+		}
+		if err := checkPasswordHistory(tx, &user, password, policy.History); err != nil {
+			return err
+		}
+		pass := utils.NewPassword(password)
+		user.Password = pass.Hash
+		user.Salt = pass.Salt
 		if err := tx.Save(&user).Error; err != nil {
 			return err
 		}
+		if err := savePasswordHistory(tx, &user, policy.History); err != nil {
+			return err
+		}
+		if err := revokeTokens(tx, user.ID, ""); err != nil {
+			return err
+		}
 		s.WorkerEvent.AddEvent(&event.SchemaEvent{
 			ModelName: "user",
 			EventType: "update_staff_password",
@@ -135,17 +188,53 @@ func (s *StaffRepository) UpdateStaffPassword(c context.Context, userUID, passwo
 		})
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(user.ID)
+	return nil
 }
 
 func (s *StaffRepository) DeleteStaff(c context.Context, userUID string) error {
-	return s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
-		var user models.User
+	var user models.User
+	err := s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("uid = ?", userUID).First(&user).Error; err != nil {
 			return err
 		}
 		if err := tx.Where("user_id = ? ", user.ID).Delete(&models.UserPermission{}).Error; err != nil {
 			return err
 		}
+		if err := deleteTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&entities.UserPasswordHistory{}).Error; err != nil {
+			return err
+		}
+		if err := deleteExternalLinks(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&entities.UserProfile{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&entities.UserStatus{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&entities.UserRole{}).Error; err != nil {
+			return err
+		}
+		// ocserv users of the staff are left to admins, who can assign them to another staff
+		if err := tx.Where("user_id = ?", user.ID).Delete(&entities.OcUserOwner{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&entities.StaffQuota{}).Error; err != nil {
+			return err
+		}
+		if err := revokeTokens(tx, user.ID, ""); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&entities.ApiKey{}).Error; err != nil {
+			return err
+		}
 		err := tx.Delete(&user).Error
 		if err != nil {
 			return err
@@ -157,4 +246,9 @@ func (s *StaffRepository) DeleteStaff(c context.Context, userUID string) error {
 		})
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(user.ID)
+	return nil
 }
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"api/pkg/tokencache"
+	"context"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	errAccountDisabled = errors.New("account is disabled")
+	errAccountExpired  = errors.New("account is expired")
+)
+
+// ActiveUsers limit query to rows whose user id column is not a disabled or expired staff
+func ActiveUsers(tx *gorm.DB, column string) *gorm.DB {
+	return tx.Where(
+		column+" NOT IN (SELECT user_id FROM user_statuses WHERE disabled OR (expire_at IS NOT NULL AND expire_at <= ?))",
+		time.Now(),
+	)
+}
+
+// userStatus status of user, users without a status are active
+func userStatus(tx *gorm.DB, userID uint) (*entities.UserStatus, error) {
+	status := entities.UserStatus{UserID: userID}
+	err := tx.Where("user_id = ?", userID).First(&status).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// checkStatus return why the account of status can not be used at now
+func checkStatus(status *entities.UserStatus, now time.Time) error {
+	if status.Disabled {
+		return errAccountDisabled
+	}
+	if status.ExpireAt != nil && !status.ExpireAt.After(now) {
+		return errAccountExpired
+	}
+	return nil
+}
+
+// StaffStatus account state of staff
+func (s *StaffRepository) StaffStatus(c context.Context, userUID string) (*entities.UserStatus, error) {
+	var user models.User
+	if err := s.db.WithContext(c).Select("id").Where("uid = ? AND is_admin = ?", userUID, false).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return userStatus(s.db.WithContext(c), user.ID)
+}
+
+// updateStatus change the status of staff with update, revoke its tokens when revoke is set and
+// record eventType
+func (s *StaffRepository) updateStatus(
+	c context.Context, userUID, eventType string, revoke bool, update func(status *entities.UserStatus),
+) (*entities.UserStatus, error) {
+	var (
+		user                 models.User
+		oldStatus, newStatus entities.UserStatus
+	)
+	err := s.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "uid").
+			Where("uid = ? AND is_admin = ?", userUID, false).
+			First(&user).Error
+		if err != nil {
+			return err
+		}
+		status, err := userStatus(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		oldStatus = *status
+		update(status)
+		if err = tx.Save(status).Error; err != nil {
+			return err
+		}
+		newStatus = *status
+		if revoke {
+			return revokeTokens(tx, user.ID, "")
+		}
+		// tokens never outlive the account
+		if status.ExpireAt != nil {
+			return tx.Model(&models.UserToken{}).
+				Where("user_id = ? AND expire_at > ?", user.ID, status.ExpireAt).
+				Update("expire_at", status.ExpireAt).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokencache.Default().Invalidate(user.ID)
+	s.WorkerEvent.AddEvent(&event.SchemaEvent{
+		ModelName: "user",
+		EventType: eventType,
+		ModelUID:  user.UID,
+		UserUID:   actorUID(c),
+		OldState:  oldStatus,
+		NewState:  newStatus,
+	})
+	return &newStatus, nil
+}
+
+// DisableStaff disable staff and revoke its tokens. Api keys of staff are kept but rejected
+// until staff is enabled.
+func (s *StaffRepository) DisableStaff(c context.Context, userUID string) (*entities.UserStatus, error) {
+	return s.updateStatus(c, userUID, "disable_staff", true, func(status *entities.UserStatus) {
+		now := time.Now()
+		status.Disabled = true
+		status.DisabledAt = &now
+	})
+}
+
+// EnableStaff enable a disabled staff, account expiry is not changed
+func (s *StaffRepository) EnableStaff(c context.Context, userUID string) (*entities.UserStatus, error) {
+	return s.updateStatus(c, userUID, "enable_staff", false, func(status *entities.UserStatus) {
+		status.Disabled = false
+		status.DisabledAt = nil
+	})
+}
+
+// SetStaffExpiry set or clear the account expiry of staff. Tokens of staff expire with the account.
+func (s *StaffRepository) SetStaffExpiry(c context.Context, userUID string, expireAt *time.Time) (*entities.UserStatus, error) {
+	return s.updateStatus(c, userUID, "update_staff_expiry", false, func(status *entities.UserStatus) {
+		status.ExpireAt = expireAt
+	})
+}
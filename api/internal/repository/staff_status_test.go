@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCheckStatus(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.NoError(t, checkStatus(&entities.UserStatus{}, now))
+	assert.NoError(t, checkStatus(&entities.UserStatus{ExpireAt: &future}, now))
+	assert.ErrorIs(t, checkStatus(&entities.UserStatus{ExpireAt: &past}, now), errAccountExpired)
+	assert.ErrorIs(t, checkStatus(&entities.UserStatus{ExpireAt: &now}, now), errAccountExpired)
+	assert.ErrorIs(t, checkStatus(&entities.UserStatus{Disabled: true, ExpireAt: &future}, now), errAccountDisabled)
+}
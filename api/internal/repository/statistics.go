@@ -36,9 +36,10 @@ func NewStatisticsRepository() *StatisticsRepository {
 	}
 }
 
+// Year traffic of a year, limited to the owned ocserv users for staff that are not admin
 func (s *StatisticsRepository) Year(c context.Context, year int) (*YearStatistics, error) {
 	var result YearStatistics
-	err := s.db.WithContext(c).Model(&models.OcUserTrafficStatistics{}).
+	err := ownedBy(c, s.db.WithContext(c), "oc_user_id").Model(&models.OcUserTrafficStatistics{}).
 		Select("TO_CHAR(date, 'YYYY') AS year, SUM(rx) AS sum_rx, SUM(tx) AS sum_tx").
 		Where("TO_CHAR(date, 'YYYY') = ?", fmt.Sprintf("%d", year)).
 		Group("TO_CHAR(date, 'YYYY'), TO_CHAR(date, 'MM')").
@@ -49,9 +50,10 @@ func (s *StatisticsRepository) Year(c context.Context, year int) (*YearStatistic
 	return &result, nil
 }
 
+// Month traffic of a month, limited to the owned ocserv users for staff that are not admin
 func (s *StatisticsRepository) Month(c context.Context, year, month int) (*MonthStatistics, error) {
 	var result MonthStatistics
-	err := s.db.WithContext(c).Model(&models.OcUserTrafficStatistics{}).
+	err := ownedBy(c, s.db.WithContext(c), "oc_user_id").Model(&models.OcUserTrafficStatistics{}).
 		Select("TO_CHAR(date, 'YYYY') AS year, TO_CHAR(date, 'MM') AS month, SUM(rx) AS sum_rx, SUM(tx) AS sum_tx").
 		Where("TO_CHAR(date, 'YYYY') = ? AND TO_CHAR(date, 'MM') = ?",
 			fmt.Sprintf("%d", year), fmt.Sprintf("%02d", month),
@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"api/internal/entities"
+	"api/pkg/event"
+	"api/pkg/utils"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorIssuer    = "Ocserv Panel"
+	recoveryCodesCount = 10
+)
+
+type TwoFactorRepository struct {
+	db          *gorm.DB
+	WorkerEvent *event.WorkerEvent
+}
+
+type TwoFactorRepositoryInterface interface {
+	Get(c context.Context, userID uint) (*entities.UserTwoFactor, error)
+	Setup(c context.Context, userID uint) (*TwoFactorSetup, error)
+	Confirm(c context.Context, userID uint, code string) ([]string, error)
+	Verify(c context.Context, userID uint, code, recoveryCode string) error
+	RecoveryCodes(c context.Context, userID uint, code string) ([]string, error)
+	Disable(c context.Context, userID uint, code string) error
+	Reset(c context.Context, userUID string) error
+}
+
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func NewTwoFactorRepository() *TwoFactorRepository {
+	return &TwoFactorRepository{
+		db:          database.Connection(),
+		WorkerEvent: event.GetWorker(),
+	}
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
+
+// newRecoveryCodes replace recovery codes of user and return plain codes to show once
+func newRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&entities.UserRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodesCount)
+	rows := make([]entities.UserRecoveryCode, recoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:5] + "-" + code[5:10]
+		rows[i] = entities.UserRecoveryCode{UserID: userID, Code: hashRecoveryCode(codes[i])}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkCode validate totp code and reject a code of an already used time step
+func checkCode(tx *gorm.DB, twoFactor *entities.UserTwoFactor, code string) error {
+	step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now())
+	if !ok || step <= twoFactor.LastStep {
+		return errors.New("invalid two factor code")
+	}
+	twoFactor.LastStep = step
+	return tx.Model(twoFactor).Update("last_step", step).Error
+}
+
+func (t *TwoFactorRepository) lockTwoFactor(tx *gorm.DB, userID uint) (*entities.UserTwoFactor, error) {
+	var twoFactor entities.UserTwoFactor
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&twoFactor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("two factor authentication is not set up")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+func (t *TwoFactorRepository) addEvent(eventType string, userID uint) {
+	t.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: eventType,
+		ModelName: "user_two_factor",
+		ModelUID:  strconv.Itoa(int(userID)),
+		UserUID:   strconv.Itoa(int(userID)),
+	})
+}
+
+// Get return two factor config of user or nil when user never started enrollment
+func (t *TwoFactorRepository) Get(c context.Context, userID uint) (*entities.UserTwoFactor, error) {
+	var twoFactor entities.UserTwoFactor
+	err := t.db.WithContext(c).Where("user_id = ?", userID).First(&twoFactor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+// Setup create a new not confirmed secret for user
+func (t *TwoFactorRepository) Setup(c context.Context, userID uint) (*TwoFactorSetup, error) {
+	var user models.User
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = t.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err = tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		var twoFactor entities.UserTwoFactor
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&twoFactor).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if twoFactor.Enabled {
+			return errors.New("two factor authentication is already enabled")
+		}
+		twoFactor.UserID = userID
+		twoFactor.Secret = secret
+		twoFactor.LastStep = 0
+		return tx.Save(&twoFactor).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    utils.TOTPURI(twoFactorIssuer, user.Username, secret),
+	}, nil
+}
+
+// Confirm enable two factor with the first valid code and return new recovery codes
+func (t *TwoFactorRepository) Confirm(c context.Context, userID uint, code string) ([]string, error) {
+	var codes []string
+	err := t.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		twoFactor, err := t.lockTwoFactor(tx, userID)
+		if err != nil {
+			return err
+		}
+		if twoFactor.Enabled {
+			return errors.New("two factor authentication is already enabled")
+		}
+		if err = checkCode(tx, twoFactor, code); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err = tx.Model(twoFactor).Updates(map[string]interface{}{
+			"enabled":      true,
+			"confirmed_at": &now,
+		}).Error; err != nil {
+			return err
+		}
+		codes, err = newRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.addEvent("enable_two_factor", userID)
+	return codes, nil
+}
+
+// Verify check totp code or consume a recovery code of user with enabled two factor
+func (t *TwoFactorRepository) Verify(c context.Context, userID uint, code, recoveryCode string) error {
+	return t.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		twoFactor, err := t.lockTwoFactor(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !twoFactor.Enabled {
+			return errors.New("two factor authentication is not enabled")
+		}
+		if code != "" {
+			return checkCode(tx, twoFactor, code)
+		}
+		if recoveryCode == "" {
+			return errors.New("two factor code or recovery code is required")
+		}
+		result := tx.Where("user_id = ? AND code = ?", userID, hashRecoveryCode(recoveryCode)).
+			Delete(&entities.UserRecoveryCode{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("invalid recovery code")
+		}
+		return nil
+	})
+}
+
+// RecoveryCodes replace recovery codes after checking a valid totp code
+func (t *TwoFactorRepository) RecoveryCodes(c context.Context, userID uint, code string) ([]string, error) {
+	var codes []string
+	err := t.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		twoFactor, err := t.lockTwoFactor(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !twoFactor.Enabled {
+			return errors.New("two factor authentication is not enabled")
+		}
+		if err = checkCode(tx, twoFactor, code); err != nil {
+			return err
+		}
+		codes, err = newRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable remove two factor of user after checking a valid totp code
+func (t *TwoFactorRepository) Disable(c context.Context, userID uint, code string) error {
+	err := t.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		twoFactor, err := t.lockTwoFactor(tx, userID)
+		if err != nil {
+			return err
+		}
+		if twoFactor.Enabled {
+			if err = checkCode(tx, twoFactor, code); err != nil {
+				return err
+			}
+		}
+		return deleteTwoFactor(tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+	t.addEvent("disable_two_factor", userID)
+	return nil
+}
+
+// Reset remove two factor of a staff by admin when the staff lost the authenticator
+func (t *TwoFactorRepository) Reset(c context.Context, userUID string) error {
+	var user models.User
+	err := t.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("uid = ?", userUID).First(&user).Error; err != nil {
+			return err
+		}
+		return deleteTwoFactor(tx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	t.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: "reset_staff_two_factor",
+		ModelName: "user_two_factor",
+		ModelUID:  user.UID,
+		UserUID:   actorUID(c),
+	})
+	return nil
+}
+
+func deleteTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&entities.UserRecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&entities.UserTwoFactor{}).Error
+}
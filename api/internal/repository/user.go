@@ -1,87 +1,396 @@
 package repository
 
 import (
+	"api/internal/entities"
+	"api/pkg/directory"
+	"api/pkg/event"
+	"api/pkg/sso"
+	"api/pkg/tokencache"
 	"api/pkg/utils"
 	"context"
 	"errors"
 	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/logger"
 	"github.com/mmtaee/go-oc-utils/models"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"strconv"
 	"time"
 )
 
 type UserRepository struct {
-	Admin AdminRepositoryInterface
-	Staff StaffRepositoryInterface
-	db    *gorm.DB
+	Admin       AdminRepositoryInterface
+	Staff       StaffRepositoryInterface
+	TwoFactor   TwoFactorRepositoryInterface
+	Lockout     LockoutRepositoryInterface
+	Directory   DirectoryRepositoryInterface
+	OIDC        OIDCRepositoryInterface
+	panel       PanelConfigRepositoryInterface
+	db          *gorm.DB
+	WorkerEvent *event.WorkerEvent
 }
 
 type UserRepositoryInterface interface {
-	Login(c context.Context, username, password string, rememberMe bool) (string, error)
+	Login(c context.Context, username, password string, rememberMe bool) (*LoginResult, error)
+	LoginTwoFactor(c context.Context, challenge, code, recoveryCode string) (*LoginResult, error)
+	LoginTwoFactorSetup(c context.Context, challenge string) (*TwoFactorSetup, error)
+	LoginOIDC(c context.Context, provider, state, code string) (*LoginResult, error)
 	Logout(context.Context) error
 	ChangePassword(c context.Context, oldPassword, newPassword string) error
 	CreateToken(c context.Context, id uint, expireAt time.Time) (string, error)
 }
 
+// LoginResult contains the token or, when a second factor is required, the challenge to exchange
+type LoginResult struct {
+	Token                  string
+	Challenge              string
+	TwoFactorSetupRequired bool
+	RecoveryCodes          []string
+}
+
+// challengeLifetime is the time to send the second factor after password check
+const challengeLifetime = 5 * time.Minute
+
 func NewUserRepository() *UserRepository {
 	return &UserRepository{
-		Admin: NewAdminRepository(),
-		Staff: NewStaffRepository(),
-		db:    database.Connection(),
+		Admin:       NewAdminRepository(),
+		Staff:       NewStaffRepository(),
+		TwoFactor:   NewTwoFactorRepository(),
+		Lockout:     NewLockoutRepository(),
+		Directory:   NewDirectoryRepository(),
+		OIDC:        NewOIDCRepository(),
+		panel:       NewPanelConfigRepository(),
+		db:          database.Connection(),
+		WorkerEvent: event.GetWorker(),
 	}
 }
 
-func (r *UserRepository) Login(c context.Context, username, passwd string, rememberMe bool) (string, error) {
-	var (
-		user     models.User
-		expireAt time.Time
-	)
-	err := r.db.WithContext(c).Where("username = ?", username).First(&user).Error
+// AuthEvent state of login, logout and password events
+type AuthEvent struct {
+	Username  string `json:"username"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Reasons of login_failed events
+const (
+	loginFailedUnknownUser = "unknown_user"
+	loginFailedPassword    = "invalid_password"
+	loginFailedTwoFactor   = "invalid_two_factor"
+	loginFailedBlocked     = "blocked"
+	loginFailedOIDC        = "invalid_oidc"
+	loginFailedDisabled    = "disabled"
+	loginFailedExpired     = "expired"
+)
+
+// authEvent record an authentication event of user with client details from request context.
+// user may have only a username when it does not exist.
+func (r *UserRepository) authEvent(c context.Context, eventType string, user *models.User, reason string) {
+	ip, _ := c.Value("ip").(string)
+	userAgent, _ := c.Value("userAgent").(string)
+	userUID := event.SystemUserUID
+	if user.ID != 0 {
+		userUID = strconv.Itoa(int(user.ID))
+	}
+	r.WorkerEvent.AddEvent(&event.SchemaEvent{
+		EventType: eventType,
+		ModelName: "user",
+		ModelUID:  user.UID,
+		UserUID:   userUID,
+		NewState: AuthEvent{
+			Username:  user.Username,
+			IP:        ip,
+			UserAgent: userAgent,
+			Reason:    reason,
+		},
+	})
+}
+
+// errInvalidCredentials same error for unknown username and wrong password to not reveal usernames
+var errInvalidCredentials = errors.New("invalid username and password")
+
+func (r *UserRepository) Login(c context.Context, username, passwd string, rememberMe bool) (*LoginResult, error) {
+	ip, _ := c.Value("ip").(string)
+	if err := r.Lockout.Check(c, username, ip); err != nil {
+		r.authEvent(c, "login_failed", &models.User{Username: username}, loginFailedBlocked)
+		return nil, err
+	}
+
+	user, err := r.checkCredentials(c, username, passwd, ip)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if _, err = r.activeStatus(c, user); err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := r.TwoFactor.Get(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		return &LoginResult{
+			Challenge: utils.CreateChallenge(user.ID, rememberMe, time.Now().Add(challengeLifetime)),
+		}, nil
+	}
+	settings, err := r.panel.GetSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	if settings.TwoFactorRequired {
+		return &LoginResult{
+			Challenge:              utils.CreateChallenge(user.ID, rememberMe, time.Now().Add(challengeLifetime)),
+			TwoFactorSetupRequired: true,
+		}, nil
+	}
+	return r.loginToken(c, user, rememberMe)
+}
+
+// checkCredentials check password of local users, or of directory users and unknown usernames
+// with the directory when it is enabled. Local users, such as the superuser, keep working
+// when the directory is enabled or unreachable.
+func (r *UserRepository) checkCredentials(c context.Context, username, passwd, ip string) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(c).Where("username = ?", username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	found := err == nil
+
+	linked := false
+	if found {
+		if linked, err = r.Directory.Linked(c, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	if r.Directory.Enabled() && (!found || linked) {
+		directoryUser, err := r.Directory.Login(c, username, passwd)
+		if errors.Is(err, directory.ErrInvalidCredentials) {
+			if !found {
+				return nil, r.loginFailed(c, &models.User{Username: username}, ip, loginFailedUnknownUser)
+			}
+			return nil, r.loginFailed(c, &user, ip, loginFailedPassword)
+		}
+		if err != nil {
+			logger.Logf(logger.ERROR, "directory login of user %s failed: %v", username, err)
+			return nil, err
+		}
+		return directoryUser, nil
 	}
 
+	if !found {
+		return nil, r.loginFailed(c, &models.User{Username: username}, ip, loginFailedUnknownUser)
+	}
 	if !utils.Check(passwd, user.Password, user.Salt) {
-		return "", errors.New("invalid username and password")
+		return nil, r.loginFailed(c, &user, ip, loginFailedPassword)
+	}
+	if utils.NeedsRehash(user.Password) {
+		r.rehashPassword(c, &user, passwd)
+	}
+	return &user, nil
+}
+
+// LoginTwoFactor exchange a login challenge and a second factor with a token.
+// When two factor is mandatory and the user has a pending setup, the code confirms it.
+func (r *UserRepository) LoginTwoFactor(c context.Context, challengeToken, code, recoveryCode string) (*LoginResult, error) {
+	challenge, err := utils.ParseChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err = r.db.WithContext(c).Select("id", "uid", "username").First(&user, challenge.UserID).Error; err != nil {
+		return nil, err
+	}
+	ip, _ := c.Value("ip").(string)
+	if err = r.Lockout.Check(c, user.Username, ip); err != nil {
+		r.authEvent(c, "login_failed", &user, loginFailedBlocked)
+		return nil, err
+	}
+	twoFactor, err := r.TwoFactor.Get(c, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil {
+		return nil, errors.New("two factor authentication is not set up")
+	}
+	if twoFactor.Enabled {
+		if err = r.TwoFactor.Verify(c, challenge.UserID, code, recoveryCode); err != nil {
+			return nil, r.twoFactorFailed(c, &user, ip, err)
+		}
+		return r.loginToken(c, &user, challenge.RememberMe)
+	}
+
+	recoveryCodes, err := r.TwoFactor.Confirm(c, challenge.UserID, code)
+	if err != nil {
+		return nil, r.twoFactorFailed(c, &user, ip, err)
+	}
+	result, err := r.loginToken(c, &user, challenge.RememberMe)
+	if err != nil {
+		return nil, err
+	}
+	result.RecoveryCodes = recoveryCodes
+	return result, nil
+}
+
+// LoginOIDC exchange the code of a single sign-on login with a token. The identity provider is
+// responsible for the second factor, so panel two factor is not asked.
+func (r *UserRepository) LoginOIDC(c context.Context, provider, state, code string) (*LoginResult, error) {
+	user, err := r.OIDC.Finish(c, provider, state, code)
+	if err != nil {
+		if errors.Is(err, sso.ErrInvalidLogin) || errors.Is(err, errInvalidOIDCState) {
+			r.authEvent(c, "login_failed", &models.User{}, loginFailedOIDC)
+		}
+		return nil, err
+	}
+	return r.loginToken(c, user, false)
+}
+
+// loginFailed record failed password check and return the error to show
+func (r *UserRepository) loginFailed(c context.Context, user *models.User, ip, reason string) error {
+	r.authEvent(c, "login_failed", user, reason)
+	if err := r.Lockout.Fail(c, user.Username, ip); err != nil {
+		logger.Logf(logger.ERROR, "failed to record login failure of user %s: %v", user.Username, err)
+	}
+	return errInvalidCredentials
+}
+
+// twoFactorFailed record failed second factor, guessing codes counts the same as guessing passwords
+func (r *UserRepository) twoFactorFailed(c context.Context, user *models.User, ip string, err error) error {
+	r.authEvent(c, "login_failed", user, loginFailedTwoFactor)
+	if failErr := r.Lockout.Fail(c, user.Username, ip); failErr != nil {
+		logger.Logf(logger.ERROR, "failed to record login failure of user %s: %v", user.Username, failErr)
+	}
+	return err
+}
+
+// LoginTwoFactorSetup start mandatory two factor enrollment of a user that has no two factor yet
+func (r *UserRepository) LoginTwoFactorSetup(c context.Context, challengeToken string) (*TwoFactorSetup, error) {
+	challenge, err := utils.ParseChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return r.TwoFactor.Setup(c, challenge.UserID)
+}
+
+// activeStatus return the status of user, or record a failed login when the account is disabled or expired
+func (r *UserRepository) activeStatus(c context.Context, user *models.User) (*entities.UserStatus, error) {
+	status, err := userStatus(r.db.WithContext(c), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatus(status, time.Now()); err != nil {
+		reason := loginFailedDisabled
+		if errors.Is(err, errAccountExpired) {
+			reason = loginFailedExpired
+		}
+		r.authEvent(c, "login_failed", user, reason)
+		return nil, err
+	}
+	return status, nil
+}
+
+// loginToken create a token of an active user that expires at most with the account, and reset
+// the login failures of the user
+func (r *UserRepository) loginToken(c context.Context, user *models.User, rememberMe bool) (*LoginResult, error) {
+	status, err := r.activeStatus(c, user)
+	if err != nil {
+		return nil, err
 	}
+	var expireAt time.Time
 	if rememberMe {
 		expireAt = time.Now().Add(time.Hour * 24 * 30)
 	} else {
 		expireAt = time.Now().Add(time.Hour * 24)
 	}
+	if status.ExpireAt != nil && status.ExpireAt.Before(expireAt) {
+		expireAt = *status.ExpireAt
+	}
 	token, err := r.CreateToken(c, user.ID, expireAt)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	// failures are only reset once every factor passed, a right password alone does not reset them
+	if err = r.Lockout.Succeed(c, user.Username); err != nil {
+		logger.Logf(logger.ERROR, "failed to reset login failures of user %s: %v", user.Username, err)
+	}
+	r.authEvent(c, "login_success", user, "")
+	return &LoginResult{Token: token}, nil
+}
+
+// rehashPassword upgrade legacy md5 or outdated argon2id hash after a successful password check
+func (r *UserRepository) rehashPassword(c context.Context, user *models.User, passwd string) {
+	pass := utils.NewPassword(passwd)
+	err := r.db.WithContext(c).Model(user).Updates(map[string]interface{}{
+		"password": pass.Hash,
+		"salt":     pass.Salt,
+	}).Error
+	if err != nil {
+		logger.Logf(logger.ERROR, "failed to rehash password of user %s: %v", user.Username, err)
 	}
-	return token, nil
 }
 
 func (r *UserRepository) Logout(c context.Context) error {
-	userID := c.Value("userID")
+	userID, err := strconv.Atoi(c.Value("userID").(string))
+	if err != nil {
+		return err
+	}
+	var user models.User
+	if err = r.db.WithContext(c).Select("id", "uid", "username").First(&user, userID).Error; err != nil {
+		return err
+	}
 	token := c.Value("token")
-	return r.db.WithContext(c).
-		Where("token = ? AND user_id = ? ", token, userID).
-		Delete(&models.UserToken{}).Error
+	err = r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		return revokeTokens(tx, user.ID, "token = ?", token)
+	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(user.ID)
+	r.authEvent(c, "logout", &user, "")
+	return nil
 }
 
 func (r *UserRepository) ChangePassword(c context.Context, oldPasswd, newPasswd string) error {
+	policy, err := r.panel.PasswordPolicy(c)
+	if err != nil {
+		return err
+	}
 	var user models.User
-	return r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+	err = r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, c.Value("userID")).Error; err != nil {
 			return err
 		}
+		external, err := isExternalUser(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if external {
+			return errExternalManaged
+		}
 		if !utils.Check(oldPasswd, user.Password, user.Salt) {
 			return errors.New("incorrect old password")
 		}
+		if err := checkPasswordHistory(tx, &user, newPasswd, policy.History); err != nil {
+			return err
+		}
 		pass := utils.NewPassword(newPasswd)
 		user.Password = pass.Hash
 		user.Salt = pass.Salt
 		if err := tx.Save(&user).Error; err != nil {
 			return err
 		}
-		return nil
+		if err := savePasswordHistory(tx, &user, policy.History); err != nil {
+			return err
+		}
+		return revokeTokens(tx, user.ID, "token <> ?", c.Value("token"))
 	})
+	if err != nil {
+		return err
+	}
+	tokencache.Default().Invalidate(user.ID)
+	r.authEvent(c, "password_changed", &user, "")
+	return nil
 }
 
 func (r *UserRepository) CreateToken(c context.Context, id uint, expireAt time.Time) (string, error) {
@@ -90,9 +399,26 @@ func (r *UserRepository) CreateToken(c context.Context, id uint, expireAt time.T
 		Token:    utils.Create(id, expireAt),
 		ExpireAt: &expireAt,
 	}
-	err := r.db.WithContext(c).Create(&token).Error
+	err := r.db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&token).Error; err != nil {
+			return err
+		}
+		return createSession(c, tx, &token)
+	})
 	if err != nil {
 		return "", err
 	}
 	return token.Token, nil
 }
+
+// DisableTwoFactor disable two factor of user unless it is mandatory in panel settings
+func (r *UserRepository) DisableTwoFactor(c context.Context, userID uint, code string) error {
+	settings, err := r.panel.GetSettings(c)
+	if err != nil {
+		return err
+	}
+	if settings.TwoFactorRequired {
+		return errors.New("two factor authentication is mandatory")
+	}
+	return r.TwoFactor.Disable(c, userID, code)
+}
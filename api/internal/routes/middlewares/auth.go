@@ -1,9 +1,16 @@
 package middlewares
 
 import (
+	"api/internal/entities"
+	"api/internal/repository"
+	"api/pkg/rbac"
+	"api/pkg/tokencache"
+	"api/pkg/utils"
+	"context"
 	"errors"
 	"github.com/labstack/echo/v4"
 	"github.com/mmtaee/go-oc-utils/database"
+	"github.com/mmtaee/go-oc-utils/logger"
 	"github.com/mmtaee/go-oc-utils/models"
 	"gorm.io/gorm"
 	"net/http"
@@ -20,32 +27,249 @@ func unauthorized(c echo.Context) error {
 	return c.JSON(http.StatusUnauthorized, Unauthorized{Error: "invalid authentication credentials"})
 }
 
-func IsAuthenticatedMiddleware() echo.MiddlewareFunc {
+// sessionTouchInterval is the minimum time between two last use updates of a session
+const sessionTouchInterval = time.Minute
+
+// tokenStore load tokens and record their use for IsAuthenticatedMiddleware
+type tokenStore interface {
+	Find(c context.Context, token string) (*models.UserToken, error)
+	Touch(c context.Context, token *models.UserToken) error
+}
+
+type dbTokenStore struct{}
+
+// cachedTokenStore resolve tokens from the in-process token cache before the database store
+type cachedTokenStore struct {
+	store tokenStore
+	cache *tokencache.Cache
+}
+
+var tokens tokenStore = cachedTokenStore{store: dbTokenStore{}, cache: tokencache.Default()}
+
+func (s cachedTokenStore) Find(c context.Context, tokenString string) (*models.UserToken, error) {
+	if token, ok := s.cache.Get(tokenString); ok {
+		return token, nil
+	}
+	token, err := s.store.Find(c, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(token)
+	return token, nil
+}
+
+// Touch skip the database update while the token was touched in the last sessionTouchInterval
+func (s cachedTokenStore) Touch(c context.Context, token *models.UserToken) error {
+	if !s.cache.TouchDue(token.Token, sessionTouchInterval) {
+		return nil
+	}
+	return s.store.Touch(c, token)
+}
+
+// Find fetch a not expired token of an active user with its user and permission
+func (dbTokenStore) Find(c context.Context, tokenString string) (*models.UserToken, error) {
+	token := models.UserToken{}
+	db := database.Connection()
+	err := repository.ActiveUsers(db.WithContext(c), "user_tokens.user_id").
+		Table("user_tokens").
+		Preload("User").Preload("User.Permission").
+		Where("token = ? AND expire_at > ?", tokenString, time.Now()).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Touch update last use of token session at most once per sessionTouchInterval
+func (dbTokenStore) Touch(c context.Context, token *models.UserToken) error {
+	now := time.Now()
+	return database.Connection().WithContext(c).Model(&entities.UserSession{}).
+		Where("user_token_id = ? AND (last_used_at IS NULL OR last_used_at < ?)", token.ID, now.Add(-sessionTouchInterval)).
+		Update("last_used_at", now).Error
+}
+
+// roleStore load the role actions of staff users for IsAuthenticatedMiddleware
+type roleStore interface {
+	Actions(c context.Context, userID uint) ([]string, error)
+}
+
+type dbRoleStore struct{}
+
+// cachedRoleStore resolve role actions from the in-process token cache before the database store
+type cachedRoleStore struct {
+	store roleStore
+	cache *tokencache.Cache
+}
+
+var roles roleStore = cachedRoleStore{store: dbRoleStore{}, cache: tokencache.Default()}
+
+func (s cachedRoleStore) Actions(c context.Context, userID uint) ([]string, error) {
+	if actions, ok := s.cache.Actions(userID); ok {
+		return actions, nil
+	}
+	actions, err := s.store.Actions(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.SetActions(userID, actions)
+	return actions, nil
+}
+
+// Actions fetch the actions of all roles of a user
+func (dbRoleStore) Actions(c context.Context, userID uint) ([]string, error) {
+	return repository.UserActions(database.Connection().WithContext(c), userID)
+}
+
+// apiKeyStore load api keys and record their use for IsAuthenticatedMiddleware
+type apiKeyStore interface {
+	Find(c context.Context, hash string) (*entities.ApiKey, error)
+	Touch(c context.Context, apiKey *entities.ApiKey) error
+}
+
+type dbApiKeyStore struct{}
+
+var apiKeys apiKeyStore = dbApiKeyStore{}
+
+// Find fetch a not expired api key of an active owner by hash with its owner and owner permission
+func (dbApiKeyStore) Find(c context.Context, hash string) (*entities.ApiKey, error) {
+	apiKey := entities.ApiKey{}
+	err := repository.ActiveUsers(database.Connection().WithContext(c), "api_keys.user_id").
+		Preload("User").Preload("User.Permission").
+		Where("hash = ? AND (expire_at IS NULL OR expire_at > ?)", hash, time.Now()).
+		First(&apiKey).Error
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// Touch update last use of api key at most once per sessionTouchInterval
+func (dbApiKeyStore) Touch(c context.Context, apiKey *entities.ApiKey) error {
+	now := time.Now()
+	return database.Connection().WithContext(c).Model(&entities.ApiKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-sessionTouchInterval)).
+		Update("last_used_at", now).Error
+}
+
+// apiKeyActions actions of the api key owner limited to the areas of the api key scope
+func apiKeyActions(apiKey *entities.ApiKey, owner []string) rbac.Set {
+	if apiKey.User.IsAdmin {
+		owner = make([]string, 0, len(rbac.Actions))
+		for _, action := range rbac.Actions {
+			owner = append(owner, string(action))
+		}
+	}
+	scope := models.UserPermission{
+		OcUser:    apiKey.OcUser,
+		OcGroup:   apiKey.OcGroup,
+		Statistic: apiKey.Statistic,
+		Occtl:     apiKey.Occtl,
+		System:    apiKey.System,
+	}
+	actions := rbac.Set{}
+	for _, action := range owner {
+		if rbac.AreaGranted(scope, rbac.Action(action).Area()) {
+			actions[rbac.Action(action)] = struct{}{}
+		}
+	}
+	return actions
+}
+
+// credential read api key from X-API-Key header or token or api key from Authorization header
+func credential(c echo.Context) string {
+	if apiKey := c.Request().Header.Get("X-API-Key"); apiKey != "" {
+		return apiKey
+	}
+	return strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+}
+
+func authenticateToken(c echo.Context, next echo.HandlerFunc, tokenString string) error {
+	token, err := tokens.Find(c.Request().Context(), tokenString)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return unauthorized(c)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+	if err = tokens.Touch(c.Request().Context(), token); err != nil {
+		logger.Logf(logger.WARNING, "failed to update session last use: %v", err)
+	}
+
+	c.Set("userID", strconv.Itoa(int(token.User.ID)))
+	c.Set("username", token.User.Username)
+	c.Set("isAdmin", token.User.IsAdmin)
+	c.Set("token", token.Token)
+	if !token.User.IsAdmin {
+		actions, err := roles.Actions(c.Request().Context(), token.User.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, nil)
+		}
+		c.Set("actions", rbac.NewSet(actions...))
+		c.Set("ownerID", token.User.ID)
+	}
+	return next(c)
+}
+
+// authenticateApiKey authenticate request as the api key owner with the api key scope.
+// Api keys never get admin permission and the api key uid is added to request context
+// to attribute events to the key.
+func authenticateApiKey(c echo.Context, next echo.HandlerFunc, key string) error {
+	apiKey, err := apiKeys.Find(c.Request().Context(), utils.HashApiKey(key))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return unauthorized(c)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, nil)
+	}
+	// RealIP only trusts forwarded headers of the proxies configured on the engine ip extractor
+	if !utils.IPAllowed(apiKey.AllowedIPs, c.RealIP()) {
+		return PermissionDeniedResponse(c, "api key is not allowed from this ip")
+	}
+	if err = apiKeys.Touch(c.Request().Context(), apiKey); err != nil {
+		logger.Logf(logger.WARNING, "failed to update api key last use: %v", err)
+	}
+	var owner []string
+	if !apiKey.User.IsAdmin {
+		if owner, err = roles.Actions(c.Request().Context(), apiKey.UserID); err != nil {
+			return c.JSON(http.StatusInternalServerError, nil)
+		}
+	}
+
+	c.Set("userID", strconv.Itoa(int(apiKey.UserID)))
+	c.Set("username", apiKey.User.Username)
+	c.Set("isAdmin", false)
+	c.Set("apiKeyUID", apiKey.UID)
+	c.Set("actions", apiKeyActions(apiKey, owner))
+	if !apiKey.User.IsAdmin {
+		c.Set("ownerID", apiKey.UserID)
+	}
+	ctx := context.WithValue(c.Request().Context(), "apiKeyUID", apiKey.UID)
+	c.SetRequest(c.Request().WithContext(ctx))
+	return next(c)
+}
+
+func authenticate(allowApiKey bool) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			token := models.UserToken{}
-			tokenString := c.Request().Header.Get("Authorization")
-			tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-			db := database.Connection()
-			err := db.WithContext(c.Request().Context()).
-				Table("user_tokens").
-				Preload("User").Preload("User.Permission").
-				Where("token = ? AND expire_at > ?", tokenString, time.Now()).
-				First(&token).Error
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return unauthorized(c)
-			} else if err != nil {
-				return c.JSON(http.StatusInternalServerError, nil)
+			credentials := credential(c)
+			if !utils.IsApiKey(credentials) {
+				return authenticateToken(c, next, credentials)
 			}
-
-			c.Set("userID", strconv.Itoa(int(token.User.ID)))
-			c.Set("username", token.User.Username)
-			c.Set("isAdmin", token.User.IsAdmin)
-			c.Set("token", token.Token)
-			if !token.User.IsAdmin {
-				c.Set("permission", token.User.Permission)
+			if !allowApiKey {
+				return PermissionDeniedResponse(c, "api key is not allowed for this request")
 			}
-			return next(c)
+			return authenticateApiKey(c, next, credentials)
 		}
 	}
 }
+
+// IsAuthenticatedMiddleware authenticate request with a login token or an api key.
+// Requests of staff that are not admin get ownerID to limit ocserv users to the ones they own.
+func IsAuthenticatedMiddleware() echo.MiddlewareFunc {
+	return authenticate(true)
+}
+
+// IsTokenAuthenticatedMiddleware authenticate request with a login token only. It protects
+// account routes such as password, sessions and api keys from api keys.
+func IsTokenAuthenticatedMiddleware() echo.MiddlewareFunc {
+	return authenticate(false)
+}
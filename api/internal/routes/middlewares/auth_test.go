@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"api/pkg/tokencache"
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type countingTokenStore struct {
+	finds   int
+	touches int
+}
+
+func (s *countingTokenStore) Find(c context.Context, token string) (*models.UserToken, error) {
+	s.finds++
+	expireAt := time.Now().Add(time.Hour)
+	return &models.UserToken{UserID: 1, Token: token, ExpireAt: &expireAt}, nil
+}
+
+func (s *countingTokenStore) Touch(c context.Context, token *models.UserToken) error {
+	s.touches++
+	return nil
+}
+
+func TestCachedTokenStore(t *testing.T) {
+	db := &countingTokenStore{}
+	store := cachedTokenStore{store: db, cache: tokencache.New(10, time.Minute)}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		token, err := store.Find(ctx, "token")
+		assert.NoError(t, err)
+		assert.NoError(t, store.Touch(ctx, token))
+	}
+	assert.Equal(t, 1, db.finds)
+	assert.Equal(t, 1, db.touches)
+
+	store.cache.Invalidate(1)
+	_, err := store.Find(ctx, "token")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, db.finds)
+}
+
+func serveOwner(t *testing.T, user models.User) interface{} {
+	oldTokens, oldRoles := tokens, roles
+	tokens = funcTokenStore(func(c context.Context, token string) (*models.UserToken, error) {
+		return &models.UserToken{Token: token, User: user}, nil
+	})
+	roles = funcRoleStore(func(c context.Context, userID uint) ([]string, error) {
+		return nil, nil
+	})
+	t.Cleanup(func() {
+		tokens, roles = oldTokens, oldRoles
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	var owner interface{}
+	err := IsAuthenticatedMiddleware()(func(c echo.Context) error {
+		owner = c.Get("ownerID")
+		return nil
+	})(c)
+	assert.NoError(t, err)
+	return owner
+}
+
+func TestOwnerID(t *testing.T) {
+	assert.Equal(t, uint(7), serveOwner(t, models.User{ID: 7}))
+	assert.Nil(t, serveOwner(t, models.User{ID: 1, IsAdmin: true}))
+}
@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"api/internal/entities"
+	"context"
+	"github.com/mmtaee/go-oc-utils/models"
+)
+
+type funcTokenStore func(c context.Context, token string) (*models.UserToken, error)
+
+func (f funcTokenStore) Find(c context.Context, token string) (*models.UserToken, error) {
+	return f(c, token)
+}
+
+func (f funcTokenStore) Touch(c context.Context, token *models.UserToken) error {
+	return nil
+}
+
+// SetFindToken replace the token lookup of IsAuthenticatedMiddleware and return a restore function
+func SetFindToken(fn func(c context.Context, token string) (*models.UserToken, error)) func() {
+	old := tokens
+	tokens = funcTokenStore(fn)
+	return func() {
+		tokens = old
+	}
+}
+
+type funcApiKeyStore func(c context.Context, hash string) (*entities.ApiKey, error)
+
+func (f funcApiKeyStore) Find(c context.Context, hash string) (*entities.ApiKey, error) {
+	return f(c, hash)
+}
+
+func (f funcApiKeyStore) Touch(c context.Context, apiKey *entities.ApiKey) error {
+	return nil
+}
+
+// SetFindApiKey replace the api key lookup of IsAuthenticatedMiddleware and return a restore function
+func SetFindApiKey(fn func(c context.Context, hash string) (*entities.ApiKey, error)) func() {
+	old := apiKeys
+	apiKeys = funcApiKeyStore(fn)
+	return func() {
+		apiKeys = old
+	}
+}
+
+type funcRoleStore func(c context.Context, userID uint) ([]string, error)
+
+func (f funcRoleStore) Actions(c context.Context, userID uint) ([]string, error) {
+	return f(c, userID)
+}
+
+// SetFindActions replace the role actions lookup of IsAuthenticatedMiddleware and return a restore function
+func SetFindActions(fn func(c context.Context, userID uint) ([]string, error)) func() {
+	old := roles
+	roles = funcRoleStore(fn)
+	return func() {
+		roles = old
+	}
+}
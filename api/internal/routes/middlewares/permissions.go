@@ -1,6 +1,8 @@
 package middlewares
 
 import (
+	"api/pkg/rbac"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"strings"
@@ -35,3 +37,25 @@ func IsAdminPermissionMiddleware() echo.MiddlewareFunc {
 		}
 	}
 }
+
+// HasAction report whether the request user is an admin or holds action
+func HasAction(c echo.Context, action rbac.Action) bool {
+	if isAdmin, ok := c.Get("isAdmin").(bool); ok && isAdmin {
+		return true
+	}
+	actions, ok := c.Get("actions").(rbac.Set)
+	return ok && actions.Has(action)
+}
+
+// ActionMiddleware allow admins and staffs that hold action through their roles.
+// It must be used after IsAuthenticatedMiddleware.
+func ActionMiddleware(action rbac.Action) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !HasAction(c, action) {
+				return PermissionDeniedResponse(c, fmt.Sprintf("%s permission required", action))
+			}
+			return next(c)
+		}
+	}
+}
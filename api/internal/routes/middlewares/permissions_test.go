@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"api/pkg/rbac"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveAction(isAdmin interface{}, actions interface{}, mw echo.MiddlewareFunc) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if isAdmin != nil {
+		c.Set("isAdmin", isAdmin)
+	}
+	if actions != nil {
+		c.Set("actions", actions)
+	}
+	_ = mw(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})(c)
+	return rec
+}
+
+func TestActionMiddlewareAdmin(t *testing.T) {
+	rec := serveAction(true, nil, ActionMiddleware(rbac.OcUserDelete))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestActionMiddlewareAllowed(t *testing.T) {
+	for _, action := range rbac.Actions {
+		rec := serveAction(false, rbac.NewSet(string(action)), ActionMiddleware(action))
+		assert.Equal(t, http.StatusOK, rec.Code, action)
+	}
+}
+
+func TestActionMiddlewareDenied(t *testing.T) {
+	actions := rbac.NewSet(rbac.AreaActions(rbac.OcUserArea)...)
+	delete(actions, rbac.OcUserDelete)
+	rec := serveAction(false, actions, ActionMiddleware(rbac.OcUserDelete))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	var body PermissionDenied
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "oc_user.delete permission required", body.Error)
+}
+
+func TestActionMiddlewareWithoutActions(t *testing.T) {
+	rec := serveAction(nil, nil, ActionMiddleware(rbac.StatisticRead))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
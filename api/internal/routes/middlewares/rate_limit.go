@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval how often limiters of clients that stopped sending requests are removed
+const rateLimitSweepInterval = time.Minute
+
+var rateLimiters = struct {
+	sync.Mutex
+	clients map[string]*rate.Limiter
+	sweptAt time.Time
+}{
+	clients: make(map[string]*rate.Limiter),
+}
+
+func getLimiter(k string, r rate.Limit, burst int, now time.Time) *rate.Limiter {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+	if now.Sub(rateLimiters.sweptAt) >= rateLimitSweepInterval {
+		sweepLimiters(rateLimiters.clients, now)
+		rateLimiters.sweptAt = now
+	}
+	if limited, exists := rateLimiters.clients[k]; exists {
+		return limited
+	}
+	limiter := rate.NewLimiter(r, burst)
+	rateLimiters.clients[k] = limiter
+	return limiter
+}
+
+// sweepLimiters remove limiters that refilled their burst. They allow the same as a new limiter,
+// so clients are not limited less, and limiters of unauthenticated routes do not grow without limit.
+func sweepLimiters(clients map[string]*rate.Limiter, now time.Time) {
+	for k, limiter := range clients {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(clients, k)
+		}
+	}
+}
+
+func calculateRateLimit(count int, per string) (rate.Limit, error) {
+	switch strings.ToLower(per) {
+	case "s", "seconds", "second":
+		return rate.Limit(float64(count)), nil // Per second
+	case "m", "minutes", "minute":
+		return rate.Limit(float64(count) / 60), nil // Per minute
+	case "h", "hours", "hour":
+		return rate.Limit(float64(count) / 3600), nil // Per hour
+	default:
+		return 0, fmt.Errorf("invalid time unit: %s", per)
+	}
+}
+
+func RateLimitMiddleware(count int, per string, burst int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := fmt.Sprintf("%s:%s", c.Path(), c.RealIP())
+			r, err := calculateRateLimit(count, per)
+			if err != nil {
+				panic(err)
+			}
+			limiter := getLimiter(key, r, burst, time.Now())
+			if !limiter.Allow() {
+				return c.JSON(http.StatusTooManyRequests, map[string]string{
+					"message": "Rate limit exceeded",
+				})
+			}
+			return next(c)
+		}
+	}
+}
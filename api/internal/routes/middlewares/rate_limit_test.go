@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddlewareIgnoresForwardedHeaders(t *testing.T) {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.POST("/rate_limited", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RateLimitMiddleware(1, "h", 2))
+
+	codes := make([]int, 0, 3)
+	for _, forwarded := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		req := httptest.NewRequest(http.MethodPost, "/rate_limited", nil)
+		req.RemoteAddr = "203.0.113.5:4000"
+		req.Header.Set(echo.HeaderXForwardedFor, forwarded)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestSweepLimiters(t *testing.T) {
+	now := time.Now()
+	idle := rate.NewLimiter(rate.Every(time.Minute), 2)
+	idle.AllowN(now, 1)
+	active := rate.NewLimiter(rate.Every(time.Minute), 2)
+	active.AllowN(now.Add(30*time.Second), 2)
+	clients := map[string]*rate.Limiter{"idle": idle, "active": active}
+
+	sweepLimiters(clients, now.Add(time.Minute))
+	assert.NotContains(t, clients, "idle")
+	assert.Contains(t, clients, "active")
+}
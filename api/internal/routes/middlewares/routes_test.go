@@ -0,0 +1,289 @@
+package middlewares_test
+
+import (
+	"api/internal/entities"
+	"api/internal/routes"
+	"api/internal/routes/middlewares"
+	"api/pkg/config"
+	"api/pkg/rbac"
+	"api/pkg/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type routePermission struct {
+	method string
+	path   string
+	error  string
+}
+
+// routeAction route and the action it requires
+type routeAction struct {
+	method string
+	path   string
+	action rbac.Action
+}
+
+// allExcept return every action except the given one
+func allExcept(except rbac.Action) []string {
+	var actions []string
+	for _, action := range rbac.Actions {
+		if action != except {
+			actions = append(actions, string(action))
+		}
+	}
+	return actions
+}
+
+// setActions replace the role actions of every user for the test
+func setActions(t *testing.T, actions []string) {
+	restore := middlewares.SetFindActions(func(c context.Context, userID uint) ([]string, error) {
+		return actions, nil
+	})
+	t.Cleanup(restore)
+}
+
+func newEngine(t *testing.T, actions []string) *echo.Echo {
+	config.ActiveAppInit()
+	restore := middlewares.SetFindToken(func(c context.Context, token string) (*models.UserToken, error) {
+		return &models.UserToken{
+			Token: token,
+			User: models.User{
+				ID:       1,
+				Username: "staff",
+				IsAdmin:  false,
+			},
+		}, nil
+	})
+	t.Cleanup(restore)
+	setActions(t, actions)
+	e := echo.New()
+	routes.Register(e)
+	return e
+}
+
+func assertDenied(t *testing.T, e *echo.Echo, route routePermission) {
+	req := httptest.NewRequest(route.method, route.path, nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code, "%s %s", route.method, route.path)
+	var body middlewares.PermissionDenied
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, route.error, body.Error, "%s %s", route.method, route.path)
+}
+
+// testRouteActions check each route is denied to a staff that holds every action except the
+// one the route requires
+func testRouteActions(t *testing.T, routeList []routeAction) {
+	for _, route := range routeList {
+		e := newEngine(t, allExcept(route.action))
+		assertDenied(t, e, routePermission{
+			method: route.method,
+			path:   route.path,
+			error:  fmt.Sprintf("%s permission required", route.action),
+		})
+	}
+}
+
+func TestOcUserRoutesPermission(t *testing.T) {
+	testRouteActions(t, []routeAction{
+		{http.MethodGet, "/api/v1/ocserv/users", rbac.OcUserRead},
+		{http.MethodPost, "/api/v1/ocserv/users", rbac.OcUserCreate},
+		{http.MethodPost, "/api/v1/ocserv/users/import", rbac.OcUserCreate},
+		{http.MethodPost, "/api/v1/ocserv/users/bulk", rbac.OcUserRead},
+		{http.MethodGet, "/api/v1/ocserv/users/export", rbac.OcUserRead},
+		{http.MethodGet, "/api/v1/ocserv/users/uid", rbac.OcUserRead},
+		{http.MethodPatch, "/api/v1/ocserv/users/uid", rbac.OcUserUpdate},
+		{http.MethodPost, "/api/v1/ocserv/users/uid/lock", rbac.OcUserLock},
+		{http.MethodPost, "/api/v1/ocserv/users/uid/disconnect", rbac.OcUserDisconnect},
+		{http.MethodDelete, "/api/v1/ocserv/users/uid", rbac.OcUserDelete},
+		{http.MethodGet, "/api/v1/ocserv/users/uid/statistics", rbac.OcUserRead},
+		{http.MethodGet, "/api/v1/ocserv/users/uid/activities", rbac.OcUserRead},
+		{http.MethodGet, "/api/v1/ocserv/users/uid/statistics/export", rbac.OcUserRead},
+		{http.MethodGet, "/api/v1/ocserv/users/uid/activities/export", rbac.OcUserRead},
+	})
+}
+
+func TestOcGroupRoutesPermission(t *testing.T) {
+	testRouteActions(t, []routeAction{
+		{http.MethodGet, "/api/v1/ocserv/groups/defaults", rbac.OcGroupRead},
+		{http.MethodGet, "/api/v1/ocserv/groups", rbac.OcGroupRead},
+		{http.MethodPost, "/api/v1/ocserv/groups", rbac.OcGroupWrite},
+		{http.MethodGet, "/api/v1/ocserv/groups/name", rbac.OcGroupRead},
+		{http.MethodPatch, "/api/v1/ocserv/groups/name", rbac.OcGroupWrite},
+		{http.MethodDelete, "/api/v1/ocserv/groups/name", rbac.OcGroupWrite},
+		{http.MethodGet, "/api/v1/ocserv/groups/names", rbac.OcGroupRead},
+	})
+}
+
+func TestOcctlRoutesPermission(t *testing.T) {
+	testRouteActions(t, []routeAction{
+		{http.MethodPost, "/api/v1/occtl/reload", rbac.OcctlReload},
+		{http.MethodGet, "/api/v1/occtl/online", rbac.OcctlRead},
+		{http.MethodPost, "/api/v1/occtl/disconnect/username", rbac.OcctlDisconnect},
+		{http.MethodGet, "/api/v1/occtl/ip_bans", rbac.OcctlRead},
+		{http.MethodGet, "/api/v1/occtl/ip_bans/point", rbac.OcctlRead},
+		{http.MethodPost, "/api/v1/occtl/unban", rbac.OcctlUnban},
+		{http.MethodGet, "/api/v1/occtl/status", rbac.OcctlRead},
+		{http.MethodGet, "/api/v1/occtl/users/username", rbac.OcctlRead},
+	})
+}
+
+func TestStatisticsRoutesPermission(t *testing.T) {
+	testRouteActions(t, []routeAction{
+		{http.MethodGet, "/api/v1/statistics", rbac.StatisticRead},
+	})
+}
+
+func TestEventsRoutesPermission(t *testing.T) {
+	testRouteActions(t, []routeAction{
+		{http.MethodGet, "/api/v1/events/create_oc_user", rbac.SystemRead},
+	})
+}
+
+func TestAdminRoutesPermission(t *testing.T) {
+	admin := "admin permission required"
+	e := newEngine(t, allExcept(""))
+	for _, route := range []routePermission{
+		{http.MethodGet, "/api/v1/staffs", admin},
+		{http.MethodPost, "/api/v1/staffs", admin},
+		{http.MethodPost, "/api/v1/staffs/uid", admin},
+		{http.MethodDelete, "/api/v1/staffs/uid", admin},
+		{http.MethodGet, "/api/v1/staffs/uid/permission", admin},
+		{http.MethodPatch, "/api/v1/staffs/uid/permission", admin},
+		{http.MethodDelete, "/api/v1/staffs/uid/two_factor", admin},
+		{http.MethodGet, "/api/v1/staffs/uid/status", admin},
+		{http.MethodPost, "/api/v1/staffs/uid/disable", admin},
+		{http.MethodPost, "/api/v1/staffs/uid/enable", admin},
+		{http.MethodPatch, "/api/v1/staffs/uid/expiry", admin},
+		{http.MethodGet, "/api/v1/staffs/uid/sessions", admin},
+		{http.MethodDelete, "/api/v1/staffs/uid/sessions", admin},
+		{http.MethodDelete, "/api/v1/staffs/uid/sessions/1", admin},
+		{http.MethodGet, "/api/v1/staffs/lockouts", admin},
+		{http.MethodDelete, "/api/v1/staffs/lockouts", admin},
+		{http.MethodDelete, "/api/v1/staffs/lockouts/1", admin},
+		{http.MethodGet, "/api/v1/staffs/roles", admin},
+		{http.MethodPost, "/api/v1/staffs/roles", admin},
+		{http.MethodGet, "/api/v1/staffs/roles/actions", admin},
+		{http.MethodPatch, "/api/v1/staffs/roles/1", admin},
+		{http.MethodDelete, "/api/v1/staffs/roles/1", admin},
+		{http.MethodGet, "/api/v1/staffs/uid/roles", admin},
+		{http.MethodPut, "/api/v1/staffs/uid/roles", admin},
+		{http.MethodGet, "/api/v1/staffs/uid/quota", admin},
+		{http.MethodPut, "/api/v1/staffs/uid/quota", admin},
+		{http.MethodGet, "/api/v1/panel/config", admin},
+		{http.MethodPatch, "/api/v1/panel/config", admin},
+		{http.MethodPost, "/api/v1/ocserv/groups/defaults", admin},
+		{http.MethodPatch, "/api/v1/ocserv/users/uid/owner", admin},
+		{http.MethodPost, "/api/v1/ocserv/users/import/ocpasswd", admin},
+		{http.MethodGet, "/api/v1/ocserv/users/ocpasswd/drift", admin},
+		{http.MethodPost, "/api/v1/ocserv/users/ocpasswd/repair", admin},
+		{http.MethodGet, "/api/v1/ocserv/users/operations", admin},
+		{http.MethodPost, "/api/v1/ocserv/users/operations/1/retry", admin},
+	} {
+		assertDenied(t, e, route)
+	}
+}
+
+func newApiKeyEngine(t *testing.T, apiKey entities.ApiKey) (*echo.Echo, string) {
+	config.ActiveAppInit()
+	key, _, err := utils.NewApiKey()
+	assert.NoError(t, err)
+	restore := middlewares.SetFindApiKey(func(c context.Context, hash string) (*entities.ApiKey, error) {
+		if hash != utils.HashApiKey(key) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return &apiKey, nil
+	})
+	t.Cleanup(restore)
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	routes.Register(e)
+	return e, key
+}
+
+func serveApiKey(e *echo.Echo, method, path, key string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "10.0.0.5:41000"
+	req.Header.Set("X-API-Key", key)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestApiKeyRoutesPermission(t *testing.T) {
+	e, key := newApiKeyEngine(t, entities.ApiKey{
+		UID:    "key",
+		UserID: 1,
+		User:   models.User{ID: 1, IsAdmin: true},
+		OcUser: true,
+	})
+	for _, route := range []routePermission{
+		{http.MethodGet, "/api/v1/staffs", "admin permission required"},
+		{http.MethodGet, "/api/v1/panel/config", "admin permission required"},
+		{http.MethodGet, "/api/v1/ocserv/groups", "oc_group.read permission required"},
+		{http.MethodGet, "/api/v1/user/sessions", "api key is not allowed for this request"},
+		{http.MethodPost, "/api/v1/user/api_keys", "api key is not allowed for this request"},
+		{http.MethodPost, "/api/v1/user/change_password", "api key is not allowed for this request"},
+		{http.MethodGet, "/api/v1/user/me", "api key is not allowed for this request"},
+		{http.MethodPatch, "/api/v1/user/me", "api key is not allowed for this request"},
+	} {
+		rec := serveApiKey(e, route.method, route.path, key)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "%s %s", route.method, route.path)
+		var body middlewares.PermissionDenied
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, route.error, body.Error, "%s %s", route.method, route.path)
+	}
+
+	rec := serveApiKey(e, http.MethodGet, "/api/v1/staffs", utils.ApiKeyPrefix+"unknown")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestApiKeyScopeLimitedToOwner(t *testing.T) {
+	e, key := newApiKeyEngine(t, entities.ApiKey{
+		UID:     "key",
+		UserID:  1,
+		User:    models.User{ID: 1},
+		OcUser:  true,
+		OcGroup: true,
+	})
+	setActions(t, rbac.AreaActions(rbac.OcGroupArea))
+	rec := serveApiKey(e, http.MethodGet, "/api/v1/ocserv/users", key)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	var body middlewares.PermissionDenied
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "oc_user.read permission required", body.Error)
+}
+
+func TestApiKeyAllowedIPs(t *testing.T) {
+	e, key := newApiKeyEngine(t, entities.ApiKey{
+		UID:        "key",
+		UserID:     1,
+		User:       models.User{ID: 1, IsAdmin: true},
+		AllowedIPs: "192.168.0.0/16",
+	})
+	for _, headers := range [][]string{
+		nil,
+		{echo.HeaderXRealIP, "192.168.1.1"},
+		{echo.HeaderXForwardedFor, "192.168.1.1"},
+	} {
+		rec := serveApiKey(e, http.MethodGet, "/api/v1/ocserv/users", key, headers...)
+		assert.Equal(t, http.StatusForbidden, rec.Code, headers)
+		var body middlewares.PermissionDenied
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "api key is not allowed from this ip", body.Error, headers)
+	}
+}
@@ -32,8 +32,30 @@ var EventModels = []string{
 	"update_staff_permission",
 	"update_staff_password",
 	"delete_staff",
+	"reset_staff_two_factor",
+	"update_staff_roles",
+	"update_staff_quota",
+	"disable_staff",
+	"enable_staff",
+	"update_staff_expiry",
+	"create_role",
+	"update_role",
+	"delete_role",
+
+	"login_success",
+	"login_failed",
+	"logout",
+	"password_changed",
+	"update_profile",
+
+	"enable_two_factor",
+	"disable_two_factor",
+	"login_lockout",
+	"create_api_key",
+	"revoke_api_key",
 
 	"update_panel_config",
+	"update_panel_settings",
 
 	"update_oc_default_group",
 	"create_oc_group",
@@ -44,8 +66,13 @@ var EventModels = []string{
 	"update_oc_user",
 	"lock_oc_user",
 	"unlock_oc_user",
+	"update_oc_user_owner",
 	"disconnect_oc_user",
 	"delete_oc_user",
+	"bulk_oc_users",
+	"import_ocpasswd",
+	"ocpasswd_drift",
+	"retry_oc_user_operation",
 }
 
 // Events List of events
@@ -63,7 +90,7 @@ var EventModels = []string{
 // @Param 		 user_id query string false "id of user that does this event"
 // @Param 		 date_start query string false "event date create from"
 // @Param 		 date_end query string false "event date create to"
-// @Param 		 event_type path string true "name of event type" Enums(create_staff,create_staff_permission,update_staff_permission,update_staff_password,delete_staff,update_panel_config,update_oc_default_group,create_oc_group,update_oc_group,delete_oc_group,create_oc_user,update_oc_user,lock_oc_user,unlock_oc_user,disconnect_oc_user,delete_oc_user)
+// @Param 		 event_type path string true "name of event type" Enums(create_staff,create_staff_permission,update_staff_permission,update_staff_password,delete_staff,reset_staff_two_factor,update_staff_roles,update_staff_quota,disable_staff,enable_staff,update_staff_expiry,create_role,update_role,delete_role,login_success,login_failed,logout,password_changed,update_profile,enable_two_factor,disable_two_factor,login_lockout,create_api_key,revoke_api_key,update_panel_config,update_panel_settings,update_oc_default_group,create_oc_group,update_oc_group,delete_oc_group,create_oc_user,update_oc_user,lock_oc_user,unlock_oc_user,update_oc_user_owner,disconnect_oc_user,delete_oc_user,bulk_oc_users,import_ocpasswd,ocpasswd_drift,retry_oc_user_operation)
 // @Success      200 {object} []event.SchemaEvent
 // @Failure      400 {object} utils.ErrorResponse
 // @Failure      401 {object} middlewares.Unauthorized
@@ -2,10 +2,16 @@ package events
 
 import (
 	"api/internal/routes/middlewares"
+	"api/pkg/rbac"
 	"github.com/labstack/echo/v4"
 )
 
 func Routes(e *echo.Group) {
 	controller := New()
-	e.GET("/events/:event_type", controller.Events, middlewares.IsAuthenticatedMiddleware())
+	e.GET(
+		"/events/:event_type",
+		controller.Events,
+		middlewares.IsAuthenticatedMiddleware(),
+		middlewares.ActionMiddleware(rbac.SystemRead),
+	)
 }
@@ -2,6 +2,7 @@ package ocGroup
 
 import (
 	"api/internal/routes/middlewares"
+	"api/pkg/rbac"
 	"github.com/labstack/echo/v4"
 )
 
@@ -9,14 +10,17 @@ func Routes(e *echo.Group) {
 	controller := New()
 	group := e.Group("/ocserv/groups", middlewares.IsAuthenticatedMiddleware())
 
+	read := middlewares.ActionMiddleware(rbac.OcGroupRead)
+	write := middlewares.ActionMiddleware(rbac.OcGroupWrite)
+
 	group.POST("/defaults", controller.UpdateDefaultOcservGroup, middlewares.IsAdminPermissionMiddleware())
-	group.GET("/defaults", controller.DefaultGroup)
+	group.GET("/defaults", controller.DefaultGroup, read)
 
-	group.GET("", controller.Groups)
-	group.POST("", controller.CreateGroup)
-	group.GET("/:name", controller.Group)
-	group.PATCH("/:name", controller.UpdateGroup)
-	group.DELETE("/:name", controller.DeleteGroup)
+	group.GET("", controller.Groups, read)
+	group.POST("", controller.CreateGroup, write)
+	group.GET("/:name", controller.Group, read)
+	group.PATCH("/:name", controller.UpdateGroup, write)
+	group.DELETE("/:name", controller.DeleteGroup, write)
 
-	group.GET("/names", controller.GroupNames)
+	group.GET("/names", controller.GroupNames, read)
 }
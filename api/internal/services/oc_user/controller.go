@@ -2,38 +2,77 @@ package ocUser
 
 import (
 	"api/internal/repository"
-	_ "api/internal/routes/middlewares"
+	"api/internal/routes/middlewares"
+	"api/pkg/config"
+	"api/pkg/export"
+	"api/pkg/ocpasswd"
+	"api/pkg/rbac"
 	"api/pkg/utils"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/mmtaee/go-oc-utils/models"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 type Controller struct {
-	validator      utils.CustomValidatorInterface
-	ocservUserRepo repository.OcservUserRepositoryInterface
+	validator       utils.CustomValidatorInterface
+	ocservUserRepo  repository.OcservUserRepositoryInterface
+	ocservGroupRepo repository.OcservGroupRepositoryInterface
+	outboxRepo      repository.OcUserOutboxRepositoryInterface
+	panelRepo       repository.PanelConfigRepositoryInterface
 }
 
 func New() *Controller {
 	return &Controller{
-		validator:      utils.NewCustomValidator(),
-		ocservUserRepo: repository.NewOcservUserRepository(),
+		validator:       utils.NewCustomValidator(),
+		ocservUserRepo:  repository.NewOcservUserRepository(),
+		ocservGroupRepo: repository.NewOcservGroupRepository(),
+		outboxRepo:      repository.NewOcUserOutboxRepository(),
+		panelRepo:       repository.NewPanelConfigRepository(),
 	}
 }
 
+// validatePassword check password of ocserv user against the password policy of panel settings
+func (ctrl *Controller) validatePassword(c echo.Context, password string) interface{} {
+	policy, err := ctrl.panelRepo.PasswordPolicy(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return ctrl.validator.ValidatePassword("password", password, policy)
+}
+
+// ownerContext request context with the staff of the request and the owner that ocserv users
+// are limited to
+func ownerContext(c echo.Context) context.Context {
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	return context.WithValue(ctx, "ownerID", c.Get("ownerID"))
+}
+
 // Users List of Ocserv Users
 //
 // @Summary      List of Ocserv Users
-// @Description  List of Ocserv Users with pagination
+// @Description  List of Ocserv Users with pagination and filters. Staff that are not admin only get the ocserv users they own
 // @Tags         Ocserv Users
 // @Accept       json
 // @Produce      json
 // @Param        Authorization header string true "Bearer TOKEN"
 // @Param 		 page query int false "Page number, starting from 1" minimum(1)
-// @Param 		 pager query string false "Field to order by"
+// @Param 		 page_size query int false "Number of items per page" minimum(1) maximum(100)
+// @Param 		 order query string false "Field to order by" Enums(id, username, group, traffic_type, traffic_size, rx, tx, is_locked, expire_at, created_at, updated_at)
 // @Param 		 sort query string false "Sort order, either ASC or DESC" Enums(ASC, DESC)
+// @Param 		 username query string false "Part of username"
+// @Param 		 group query string false "Group name"
+// @Param 		 traffic_type query string false "Traffic type" Enums(Free, MonthlyTransmit, MonthlyReceive, TotallyTransmit, TotallyReceive)
+// @Param 		 is_locked query bool false "Locked ocserv users"
+// @Param 		 is_online query bool false "Connected ocserv users"
+// @Param 		 expire_before query string false "Expire before date in format YYYY-MM-DD"
+// @Param 		 expire_after query string false "Expire on or after date in format YYYY-MM-DD"
+// @Param 		 expire_within query int false "Expire in the next days" minimum(1)
+// @Param 		 usage_above query int false "Used more than this percentage of the traffic size" minimum(0)
 // @Success      200  {object} OcservUsersResponse
 // @Failure      400 {object} utils.ErrorResponse
 // @Failure      401 {object} middlewares.Unauthorized
@@ -43,7 +82,11 @@ func (ctrl *Controller) Users(c echo.Context) error {
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
-	users, meta, err := ctrl.ocservUserRepo.Users(c.Request().Context(), data)
+	var filter repository.OcUserFilter
+	if err := ctrl.validator.Validate(c, &filter); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	users, meta, err := ctrl.ocservUserRepo.Users(ownerContext(c), data, &filter)
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
@@ -67,7 +110,7 @@ func (ctrl *Controller) Users(c echo.Context) error {
 // @Failure      401 {object} middlewares.Unauthorized
 // @Router       /api/v1/ocserv/users/:uid [get]
 func (ctrl *Controller) User(c echo.Context) error {
-	user, err := ctrl.ocservUserRepo.User(c.Request().Context(), c.Param("uid"))
+	user, err := ctrl.ocservUserRepo.User(ownerContext(c), c.Param("uid"))
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
@@ -77,7 +120,7 @@ func (ctrl *Controller) User(c echo.Context) error {
 // Create  Ocserv User Create
 //
 // @Summary      Create Ocserv User
-// @Description  Create Ocserv User
+// @Description  Create Ocserv User owned by the staff of the request, within the quota of staff
 // @Tags         Ocserv Users
 // @Accept       json
 // @Produce      json
@@ -92,6 +135,9 @@ func (ctrl *Controller) Create(c echo.Context) error {
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
+	if err := ctrl.validatePassword(c, *data.Password); err != nil {
+		return utils.BadRequest(c, err)
+	}
 	user := models.OcUser{
 		Group:       *data.Group,
 		Username:    *data.Username,
@@ -110,7 +156,7 @@ func (ctrl *Controller) Create(c echo.Context) error {
 	} else {
 		user.TrafficSize = 0
 	}
-	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	ctx := ownerContext(c)
 	newUser, err := ctrl.ocservUserRepo.Create(ctx, &user)
 	if err != nil {
 		return utils.BadRequest(c, err)
@@ -118,10 +164,246 @@ func (ctrl *Controller) Create(c echo.Context) error {
 	return c.JSON(http.StatusCreated, newUser)
 }
 
+// Import  Ocserv Users Import
+//
+// @Summary      Import Ocserv Users
+// @Description  Create Ocserv Users from a csv or json file with the columns username, password, group, traffic_type, traffic_size and expire_at (YYYY-MM-DD). Empty passwords are generated and returned once in the report. Every row is created on its own within the quota of staff, rows with errors are skipped. With dry_run rows are only checked.
+// @Tags         Ocserv Users
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        file formData file true "csv file with a header row, or json array of rows"
+// @Param        format formData string false "file format, by default from the file extension" Enums(csv, json)
+// @Param        dry_run query bool false "only check the rows"
+// @Success      200  {object} OcservUserImportReport
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/import [post]
+func (ctrl *Controller) Import(c echo.Context) error {
+	dryRun := false
+	if value := c.QueryParam("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			return utils.BadRequest(c, errors.New("invalid dry_run"))
+		}
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return utils.BadRequest(c, errors.New("file is required"))
+	}
+	if file.Size > maxImportSize {
+		return utils.BadRequest(c, fmt.Errorf("import file must be at most %d MB", maxImportSize>>20))
+	}
+	format, err := importFormat(c.FormValue("format"), file.Filename)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	src, err := file.Open()
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	defer src.Close()
+	rows, err := parseImport(src, format)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+
+	ctx := ownerContext(c)
+	policy, err := ctrl.panelRepo.PasswordPolicy(ctx)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	usernames := make([]string, 0, len(rows))
+	for _, row := range rows {
+		usernames = append(usernames, row.Username)
+	}
+	existing, err := ctrl.ocservUserRepo.ExistingUsernames(ctx, usernames)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	groups, err := ctrl.ocservGroupRepo.GroupNames(ctx)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	checkImportRows(rows, policy, existing, *groups)
+
+	report := OcservUserImportReport{
+		DryRun:  dryRun,
+		Created: []OcservUserImportResult{},
+		Skipped: []OcservUserImportResult{},
+	}
+	for i := range rows {
+		row := &rows[i]
+		if len(row.errs) > 0 {
+			report.Skipped = append(report.Skipped, row.result())
+			continue
+		}
+		if dryRun {
+			report.Created = append(report.Created, row.result())
+			continue
+		}
+		user, generated, err := row.ocUser(policy)
+		if err == nil {
+			user, err = ctrl.ocservUserRepo.Create(ctx, user)
+		}
+		if err != nil {
+			row.errs = append(row.errs, err.Error())
+			report.Skipped = append(report.Skipped, row.result())
+			continue
+		}
+		result := row.result()
+		result.UID = user.UID
+		result.Password = generated
+		report.Created = append(report.Created, result)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// ImportOcpasswd  Ocserv Users Import from ocpasswd
+//
+// @Summary      Import Ocserv Users from ocpasswd
+// @Description  Create the Ocserv Users of the ocpasswd file of ocserv that are missing from the panel, with the traffic of the body. Imported users keep their ocpasswd password until a new one is set. Existing usernames, unknown groups and invalid lines are reported as conflicts. With dry_run nothing is created.
+// @Tags         Ocserv Users
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request body  OcpasswdImportRequest true "Import body"
+// @Success      200  {object} repository.OcpasswdImport
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/import/ocpasswd [post]
+func (ctrl *Controller) ImportOcpasswd(c echo.Context) error {
+	var data OcpasswdImportRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	if data.TrafficType == "" {
+		data.TrafficType = models.Free
+	}
+	entries, invalid, err := ocpasswd.Read(config.GetApp().OcpasswdFile)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := ownerContext(c)
+	groups, err := ctrl.ocservGroupRepo.GroupNames(ctx)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	report, err := ctrl.ocservUserRepo.ImportOcpasswd(ctx, entries, invalid, *groups, &repository.OcpasswdImportOptions{
+		TrafficType: data.TrafficType,
+		TrafficSize: data.TrafficSize,
+		DryRun:      data.DryRun,
+	})
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// OcpasswdDrift  Ocserv Users Drift from ocpasswd
+//
+// @Summary      Ocserv Users Drift from ocpasswd
+// @Description  Compare existence, lock state and group of the Ocserv Users with the ocpasswd file of ocserv. Drifts of missing entries, entries without a user, lock state and group are reported with the invalid lines of the file.
+// @Tags         Ocserv Users
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {object} repository.OcpasswdDriftReport
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/ocpasswd/drift [get]
+func (ctrl *Controller) OcpasswdDrift(c echo.Context) error {
+	return ctrl.ocpasswdDrift(c, false)
+}
+
+// RepairOcpasswd  Ocserv Users Repair of ocpasswd
+//
+// @Summary      Repair ocpasswd
+// @Description  Change the ocpasswd file of ocserv to match the Ocserv Users. Missing entries are created, entries without a user are deleted and lock state and group are rewritten. Missing entries and groups of users imported from ocpasswd are not repaired until a new password is set. Each drift of the report tells whether it was repaired.
+// @Tags         Ocserv Users
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {object} repository.OcpasswdDriftReport
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/ocpasswd/repair [post]
+func (ctrl *Controller) RepairOcpasswd(c echo.Context) error {
+	return ctrl.ocpasswdDrift(c, true)
+}
+
+func (ctrl *Controller) ocpasswdDrift(c echo.Context, repair bool) error {
+	entries, invalid, err := ocpasswd.Read(config.GetApp().OcpasswdFile)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	report, err := ctrl.ocservUserRepo.OcpasswdDrift(ownerContext(c), entries, invalid, repair)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// Operations  Ocserv User Operations
+//
+// @Summary      Ocserv User Operations
+// @Description  Changes of ocpasswd and occtl for Ocserv Users that are not applied yet. Operations are applied after the change of the user is saved and retried with backoff when they fail. They are failed after the last attempt. Without status, the pending, running and failed operations are listed.
+// @Tags         Ocserv Users
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 status query string false "Status of operations" Enums(pending, running, failed, done)
+// @Success      200  {array} entities.OcUserOperation
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/operations [get]
+func (ctrl *Controller) Operations(c echo.Context) error {
+	var data OcservUserOperationsRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ops, err := ctrl.outboxRepo.Operations(c.Request().Context(), data.Status)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, ops)
+}
+
+// RetryOperation  Ocserv User Operation Retry
+//
+// @Summary      Retry Ocserv User Operation
+// @Description  Apply a pending or failed operation now, with all of its attempts again. The operation is returned with the outcome.
+// @Tags         Ocserv Users
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 id path int true "Operation ID"
+// @Success      200  {object} entities.OcUserOperation
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/operations/:id/retry [post]
+func (ctrl *Controller) RetryOperation(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.BadRequest(c, errors.New("invalid operation id"))
+	}
+	op, err := ctrl.outboxRepo.Retry(ownerContext(c), uint(id))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, op)
+}
+
 // Update  Ocserv User Update
 //
 // @Summary      Update Ocserv User
-// @Description  Update Ocserv User
+// @Description  Update Ocserv User within the quota of staff. Changing the password requires the oc_user.password action
 // @Tags         Ocserv Users
 // @Accept       json
 // @Produce      json
@@ -131,12 +413,26 @@ func (ctrl *Controller) Create(c echo.Context) error {
 // @Success      200  {object} models.OcUser
 // @Failure      400 {object} utils.ErrorResponse
 // @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
 // @Router       /api/v1/ocserv/users/:uid [put]
 func (ctrl *Controller) Update(c echo.Context) error {
 	var data OcservUserCreateOrUpdateRequest
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
+	changed, err := ctrl.ocservUserRepo.PasswordChanged(ownerContext(c), c.Param("uid"), *data.Password)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	if changed {
+		if !middlewares.HasAction(c, rbac.OcUserPassword) {
+			return middlewares.PermissionDeniedResponse(c, fmt.Sprintf("%s permission required", rbac.OcUserPassword))
+		}
+		// the policy only applies to new passwords, users with an older password can still be edited
+		if err := ctrl.validatePassword(c, *data.Password); err != nil {
+			return utils.BadRequest(c, err)
+		}
+	}
 	user := models.OcUser{
 		Group:       *data.Group,
 		Username:    *data.Username,
@@ -155,7 +451,7 @@ func (ctrl *Controller) Update(c echo.Context) error {
 	} else {
 		user.TrafficSize = 0
 	}
-	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	ctx := ownerContext(c)
 	updatedUser, err := ctrl.ocservUserRepo.Update(ctx, c.Param("uid"), &user)
 	if err != nil {
 		return utils.BadRequest(c, err)
@@ -190,7 +486,7 @@ func (ctrl *Controller) LockOrUnlock(c echo.Context) error {
 	} else {
 		lock = false
 	}
-	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	ctx := ownerContext(c)
 	err := ctrl.ocservUserRepo.LockOrUnLock(ctx, c.Param("uid"), lock)
 	if err != nil {
 		return utils.BadRequest(c, err)
@@ -212,7 +508,7 @@ func (ctrl *Controller) LockOrUnlock(c echo.Context) error {
 // @Failure      401 {object} middlewares.Unauthorized
 // @Router       /api/v1/ocserv/users/:uid/disconnect [post]
 func (ctrl *Controller) Disconnect(c echo.Context) error {
-	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	ctx := ownerContext(c)
 	err := ctrl.ocservUserRepo.Disconnect(ctx, c.Param("uid"))
 	if err != nil {
 		return utils.BadRequest(c, err)
@@ -234,7 +530,7 @@ func (ctrl *Controller) Disconnect(c echo.Context) error {
 // @Failure      401 {object} middlewares.Unauthorized
 // @Router       /api/v1/ocserv/users/:uid [delete]
 func (ctrl *Controller) Delete(c echo.Context) error {
-	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	ctx := ownerContext(c)
 	err := ctrl.ocservUserRepo.Delete(ctx, c.Param("uid"))
 	if err != nil {
 		return utils.BadRequest(c, err)
@@ -242,6 +538,199 @@ func (ctrl *Controller) Delete(c echo.Context) error {
 	return c.JSON(http.StatusNoContent, nil)
 }
 
+// Export  Ocserv Users Export
+//
+// @Summary      Export Ocserv Users
+// @Description  Stream the Ocserv Users of the filters of the list as csv, ndjson or xlsx. Passwords are only exported with the oc_user.export_password action
+// @Tags         Ocserv Users
+// @Produce      text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 format query string false "Export format, csv by default" Enums(csv, ndjson, xlsx)
+// @Param 		 passwords query bool false "Include passwords"
+// @Param 		 username query string false "Part of username"
+// @Param 		 group query string false "Group name"
+// @Param 		 traffic_type query string false "Traffic type" Enums(Free, MonthlyTransmit, MonthlyReceive, TotallyTransmit, TotallyReceive)
+// @Param 		 is_locked query bool false "Locked ocserv users"
+// @Param 		 is_online query bool false "Connected ocserv users"
+// @Param 		 expire_before query string false "Expire before date in format YYYY-MM-DD"
+// @Param 		 expire_after query string false "Expire on or after date in format YYYY-MM-DD"
+// @Param 		 expire_within query int false "Expire in the next days" minimum(1)
+// @Param 		 usage_above query int false "Used more than this percentage of the traffic size" minimum(0)
+// @Success      200  {file} file
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/export [get]
+func (ctrl *Controller) Export(c echo.Context) error {
+	var (
+		data   OcservUserExportRequest
+		filter repository.OcUserFilter
+	)
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	if err := ctrl.validator.Validate(c, &filter); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	if data.Passwords && !middlewares.HasAction(c, rbac.OcUserExportPassword) {
+		return middlewares.PermissionDeniedResponse(c, fmt.Sprintf("%s permission required", rbac.OcUserExportPassword))
+	}
+	header := []string{
+		"uid", "username", "group", "traffic_type", "traffic_size", "rx", "tx", "is_locked", "is_online",
+		"expire_at", "created_at",
+	}
+	if data.Passwords {
+		header = append(header, "password")
+	}
+	ctx := ownerContext(c)
+	return stream(c, "oc_users", data.Format, header, func(w export.Writer) error {
+		return ctrl.ocservUserRepo.ExportUsers(ctx, &filter, func(user *models.OcUser) error {
+			row := []interface{}{
+				user.UID, user.Username, user.Group, user.TrafficType, user.TrafficSize, user.Rx, user.Tx,
+				user.IsLocked, user.IsOnline, user.ExpireAt, user.CreatedAt,
+			}
+			if data.Passwords {
+				row = append(row, user.Password)
+			}
+			return w.Write(row...)
+		})
+	})
+}
+
+// ExportStatistics  Ocserv User Statistics Export
+//
+// @Summary      Export Ocserv User traffic
+// @Description  Stream the traffic records of Ocserv User as csv, ndjson or xlsx. Rx and tx are in bytes
+// @Tags         Ocserv Users
+// @Produce      text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "Ocserv User UID"
+// @Param 		 format query string false "Export format, csv by default" Enums(csv, ndjson, xlsx)
+// @Param 		 start query string false "Start date in format YYYY-MM-DD, null=one month before end"
+// @Param 		 end query string false "End date in format YYYY-MM-DD, included, null=time.Now()"
+// @Success      200  {file} file
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/ocserv/users/:uid/statistics/export [get]
+func (ctrl *Controller) ExportStatistics(c echo.Context) error {
+	var data OcservUserRangeExportRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	start, end, err := exportRange(data.Start, data.End)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := ownerContext(c)
+	uid := c.Param("uid")
+	if err = ctrl.ocservUserRepo.UserExists(ctx, uid); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	header := []string{"created_at", "rx", "tx"}
+	return stream(c, "oc_user_traffic", data.Format, header, func(w export.Writer) error {
+		return ctrl.ocservUserRepo.ExportStatistics(ctx, uid, start, end, func(record *repository.TrafficRecord) error {
+			return w.Write(record.CreatedAt, record.Rx, record.Tx)
+		})
+	})
+}
+
+// ExportActivities  Ocserv User Activities Export
+//
+// @Summary      Export Ocserv User activities
+// @Description  Stream the activities of Ocserv User as csv, ndjson or xlsx
+// @Tags         Ocserv Users
+// @Produce      text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "Ocserv User UID"
+// @Param 		 format query string false "Export format, csv by default" Enums(csv, ndjson, xlsx)
+// @Param 		 start query string false "Start date in format YYYY-MM-DD, null=one month before end"
+// @Param 		 end query string false "End date in format YYYY-MM-DD, included, null=time.Now()"
+// @Success      200  {file} file
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/ocserv/users/:uid/activities/export [get]
+func (ctrl *Controller) ExportActivities(c echo.Context) error {
+	var data OcservUserRangeExportRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	start, end, err := exportRange(data.Start, data.End)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := ownerContext(c)
+	uid := c.Param("uid")
+	if err = ctrl.ocservUserRepo.UserExists(ctx, uid); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	header := []string{"created_at", "type", "log"}
+	return stream(c, "oc_user_activities", data.Format, header, func(w export.Writer) error {
+		return ctrl.ocservUserRepo.ExportActivities(ctx, uid, start, end, func(activity *models.OcUserActivity) error {
+			return w.Write(activity.CreatedAt, activity.Type, activity.Log)
+		})
+	})
+}
+
+// bulkActions action that a bulk action requires
+var bulkActions = map[string]rbac.Action{
+	repository.BulkLock:         rbac.OcUserLock,
+	repository.BulkUnlock:       rbac.OcUserLock,
+	repository.BulkDisconnect:   rbac.OcUserDisconnect,
+	repository.BulkDelete:       rbac.OcUserDelete,
+	repository.BulkSetGroup:     rbac.OcUserUpdate,
+	repository.BulkExtendExpiry: rbac.OcUserUpdate,
+}
+
+// Bulk  Ocserv Users Bulk Action
+//
+// @Summary      Bulk action on Ocserv Users
+// @Description  Lock, unlock, disconnect, delete, change the group or extend the expiry of the Ocserv Users of uids or of a filter, with the result of every user. Each action requires the action of its single user endpoint.
+// @Tags         Ocserv Users
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request body  OcservUserBulkRequest true "Bulk action body"
+// @Success      200  {object} OcservUserBulkResponse
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure      403 {object} middlewares.PermissionDenied
+// @Router       /api/v1/ocserv/users/bulk [post]
+func (ctrl *Controller) Bulk(c echo.Context) error {
+	var data OcservUserBulkRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	if action := bulkActions[data.Action]; !middlewares.HasAction(c, action) {
+		return middlewares.PermissionDeniedResponse(c, fmt.Sprintf("%s permission required", action))
+	}
+	if (len(data.UIDs) == 0) == (data.Filter == nil) {
+		return utils.BadRequest(c, errors.New("one of uids or filter is required"))
+	}
+	if data.Filter != nil && data.Filter.Empty() {
+		return utils.BadRequest(c, errors.New("filter must have at least one condition"))
+	}
+	ctx := ownerContext(c)
+	action := &repository.BulkAction{
+		Action: data.Action,
+		UIDs:   data.UIDs,
+		Filter: data.Filter,
+		Group:  data.Group,
+		Days:   data.Days,
+	}
+	if data.Action == repository.BulkSetGroup {
+		groups, err := ctrl.ocservGroupRepo.GroupNames(ctx)
+		if err != nil {
+			return utils.BadRequest(c, err)
+		}
+		action.Groups = *groups
+	}
+	results, err := ctrl.ocservUserRepo.Bulk(ctx, action)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, OcservUserBulkResponse{Results: results})
+}
+
 // Statistics  Ocserv User Statistics
 //
 // @Summary      Statistics for Ocserv User
@@ -282,7 +771,7 @@ func (ctrl *Controller) Statistics(c echo.Context) error {
 			return utils.BadRequest(c, err)
 		}
 	}
-	stats, err := ctrl.ocservUserRepo.Statistics(c.Request().Context(), c.Param("uid"), dateStart, dateEnd)
+	stats, err := ctrl.ocservUserRepo.Statistics(ownerContext(c), c.Param("uid"), dateStart, dateEnd)
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
@@ -316,9 +805,36 @@ func (ctrl *Controller) Activities(c echo.Context) error {
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
-	activities, err := ctrl.ocservUserRepo.Activity(c.Request().Context(), c.Param("uid"), date)
+	activities, err := ctrl.ocservUserRepo.Activity(ownerContext(c), c.Param("uid"), date)
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
 	return c.JSON(http.StatusOK, activities)
 }
+
+// SetOwner  Ocserv User Owner
+//
+// @Summary      Set Ocserv User Owner
+// @Description  Assign Ocserv User to a staff. Staff that are not admin only see and manage the ocserv users they own
+// @Tags         Ocserv Users
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "Ocserv User UID"
+// @Param        request body  OcservUserOwnerRequest true "Ocserv User Owner Body"
+// @Success      200  {object} nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/ocserv/users/:uid/owner [patch]
+func (ctrl *Controller) SetOwner(c echo.Context) error {
+	var data OcservUserOwnerRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	err := ctrl.ocservUserRepo.SetOwner(ownerContext(c), c.Param("uid"), data.OwnerUID)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, nil)
+}
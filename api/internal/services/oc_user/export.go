@@ -0,0 +1,65 @@
+package ocUser
+
+import (
+	"api/pkg/export"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/mmtaee/go-oc-utils/logger"
+	"net/http"
+	"time"
+)
+
+// flushWriter send every write to the client, so exports are streamed as they are read
+type flushWriter struct {
+	res *echo.Response
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.res.Write(p)
+	f.res.Flush()
+	return n, err
+}
+
+// stream write an export file of format named name. Once rows are sent errors can not change
+// the response anymore, so they end the export early and are logged.
+func stream(c echo.Context, name, format string, header []string, rows func(w export.Writer) error) error {
+	if format == "" {
+		format = export.CSV
+	}
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, export.ContentType(format))
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, export.Filename(name, format)))
+	res.WriteHeader(http.StatusOK)
+	w, err := export.New(flushWriter{res: res}, format, header)
+	if err == nil {
+		if err = rows(w); err == nil {
+			err = w.Close()
+		}
+	}
+	if err != nil {
+		logger.Logf(logger.ERROR, "export %s failed: %v", name, err)
+	}
+	return nil
+}
+
+// exportRange start and end dates of an export, by default the last month
+func exportRange(start, end string) (time.Time, time.Time, error) {
+	dateEnd := time.Now()
+	if end != "" {
+		t, err := time.Parse("2006-01-02", end)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		// end date is included
+		dateEnd = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	dateStart := dateEnd.AddDate(0, -1, 0)
+	if start != "" {
+		t, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		dateStart = t
+	}
+	return dateStart, dateEnd, nil
+}
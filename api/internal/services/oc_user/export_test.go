@@ -0,0 +1,21 @@
+package ocUser
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExportRange(t *testing.T) {
+	start, end, err := exportRange("2025-01-01", "2025-01-31")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), end)
+
+	start, end, err = exportRange("", "2025-03-31")
+	assert.NoError(t, err)
+	assert.Equal(t, end.AddDate(0, -1, 0), start)
+
+	_, _, err = exportRange("01/01/2025", "")
+	assert.Error(t, err)
+}
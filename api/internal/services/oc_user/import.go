@@ -0,0 +1,216 @@
+package ocUser
+
+import (
+	"api/internal/repository"
+	"api/pkg/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mmtaee/go-oc-utils/models"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxImportSize size of an import file in bytes
+	maxImportSize = 5 << 20
+	// maxImportRows ocserv users of an import file
+	maxImportRows = 5000
+	// importDateLayout layout of expire_at in import files
+	importDateLayout = "2006-01-02"
+)
+
+var importColumns = []string{"username", "password", "group", "traffic_type", "traffic_size", "expire_at"}
+
+var trafficTypes = []string{
+	models.Free, models.MonthlyTransmit, models.MonthlyReceive, models.TotallyTransmit, models.TotallyReceive,
+}
+
+// importRow row of an import file with its number, starting from 1 after the csv header, and the
+// errors found while reading or checking it
+type importRow struct {
+	OcservUserImportRow
+	number int
+	errs   []string
+}
+
+func (r *importRow) result() OcservUserImportResult {
+	return OcservUserImportResult{Row: r.number, Username: r.Username, Errors: r.errs}
+}
+
+// importFormat format of an import file from the format field, or else from the file extension
+func importFormat(format, filename string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch format {
+	case "csv", "json":
+		return format, nil
+	}
+	return "", errors.New("import file must be csv or json")
+}
+
+// parseImport read the rows of an import file. Errors of a single row are kept on the row, the
+// error is returned when the file itself can not be read.
+func parseImport(r io.Reader, format string) ([]importRow, error) {
+	var (
+		rows []importRow
+		err  error
+	)
+	if format == "json" {
+		rows, err = parseImportJSON(r)
+	} else {
+		rows, err = parseImportCSV(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("import file has no ocserv users")
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("import file has more than %d ocserv users", maxImportRows)
+	}
+	return rows, nil
+}
+
+func parseImportJSON(r io.Reader) ([]importRow, error) {
+	var list []OcservUserImportRow
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid json import file: %w", err)
+	}
+	rows := make([]importRow, len(list))
+	for i, row := range list {
+		rows[i] = importRow{OcservUserImportRow: row, number: i + 1}
+	}
+	return rows, nil
+}
+
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv import file: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(importColumns, name) {
+			return nil, fmt.Errorf("unknown column %s, columns are %s", name, strings.Join(importColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, errors.New("username column is required")
+	}
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv import file: %w", err)
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := importRow{
+			OcservUserImportRow: OcservUserImportRow{
+				Username:    value("username"),
+				Password:    value("password"),
+				Group:       value("group"),
+				TrafficType: value("traffic_type"),
+				ExpireAt:    value("expire_at"),
+			},
+			number: len(rows) + 1,
+		}
+		if size := value("traffic_size"); size != "" {
+			if row.TrafficSize, err = strconv.Atoi(size); err != nil {
+				row.errs = append(row.errs, "traffic_size must be a number")
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// checkImportRows check the rows against the rules of creating ocserv users. Usernames must be
+// unique in the file and not taken by existing ocserv users, and groups must be the default
+// group or one of groups.
+func checkImportRows(rows []importRow, policy *utils.PasswordPolicy, existing, groups []string) {
+	seen := make(map[string]int, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		switch n := len(row.Username); {
+		case n == 0:
+			row.errs = append(row.errs, "username is required")
+		case n < 3 || n > 16:
+			row.errs = append(row.errs, "username must be 3 to 16 characters")
+		case slices.Contains(existing, row.Username):
+			row.errs = append(row.errs, "username already exists")
+		case seen[row.Username] != 0:
+			row.errs = append(row.errs, fmt.Sprintf("username is duplicate of row %d", seen[row.Username]))
+		default:
+			seen[row.Username] = row.number
+		}
+		if row.Password != "" {
+			if len(row.Password) > 16 {
+				row.errs = append(row.errs, "password must be at most 16 characters")
+			}
+			if policy != nil {
+				row.errs = append(row.errs, policy.Check("password", row.Password)...)
+			}
+		}
+		if row.Group == "" {
+			row.errs = append(row.errs, "group is required")
+		} else if row.Group != repository.DefaultGroup && !slices.Contains(groups, row.Group) {
+			row.errs = append(row.errs, fmt.Sprintf("group %s does not exist", row.Group))
+		}
+		if !slices.Contains(trafficTypes, row.TrafficType) {
+			row.errs = append(row.errs, "traffic_type must be one of "+strings.Join(trafficTypes, ", "))
+		}
+		if row.TrafficSize < 0 {
+			row.errs = append(row.errs, "traffic_size must not be negative")
+		}
+		if row.ExpireAt == "" {
+			row.errs = append(row.errs, "expire_at is required")
+		} else if _, err := time.Parse(importDateLayout, row.ExpireAt); err != nil {
+			row.errs = append(row.errs, "expire_at must be a date like "+importDateLayout)
+		}
+	}
+}
+
+// ocUser ocserv user of a checked row, the password is generated when the row has none
+func (r *importRow) ocUser(policy *utils.PasswordPolicy) (user *models.OcUser, generated string, err error) {
+	password := r.Password
+	if password == "" {
+		if generated, err = utils.GeneratePassword(policy); err != nil {
+			return nil, "", err
+		}
+		password = generated
+	}
+	expireAt, err := time.Parse(importDateLayout, r.ExpireAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return &models.OcUser{
+		Username:    r.Username,
+		Password:    password,
+		Group:       r.Group,
+		TrafficType: r.TrafficType,
+		TrafficSize: r.TrafficSize,
+		ExpireAt:    &expireAt,
+	}, generated, nil
+}
@@ -0,0 +1,100 @@
+package ocUser
+
+import (
+	"api/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestImportFormat(t *testing.T) {
+	format, err := importFormat("", "users.CSV")
+	assert.NoError(t, err)
+	assert.Equal(t, "csv", format)
+	format, err = importFormat("json", "users.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "json", format)
+	_, err = importFormat("", "users.xlsx")
+	assert.Error(t, err)
+}
+
+func TestParseImportCSV(t *testing.T) {
+	file := "\ufeffUsername, group,traffic_type,traffic_size,expire_at\n" +
+		"user1,defaults,MonthlyTransmit,20,2030-01-31\n" +
+		"user2,defaults,Free,many,2030-01-31\n"
+	rows, err := parseImport(strings.NewReader(file), "csv")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, OcservUserImportRow{
+		Username:    "user1",
+		Group:       "defaults",
+		TrafficType: "MonthlyTransmit",
+		TrafficSize: 20,
+		ExpireAt:    "2030-01-31",
+	}, rows[0].OcservUserImportRow)
+	assert.Equal(t, 2, rows[1].number)
+	assert.Equal(t, []string{"traffic_size must be a number"}, rows[1].errs)
+
+	_, err = parseImport(strings.NewReader("username,email\nuser1,a@b.c\n"), "csv")
+	assert.EqualError(t, err, "unknown column email, columns are username, password, group, traffic_type, traffic_size, expire_at")
+	_, err = parseImport(strings.NewReader("group\ndefaults\n"), "csv")
+	assert.EqualError(t, err, "username column is required")
+	_, err = parseImport(strings.NewReader("username\n"), "csv")
+	assert.EqualError(t, err, "import file has no ocserv users")
+}
+
+func TestParseImportJSON(t *testing.T) {
+	rows, err := parseImport(strings.NewReader(`[{"username":"user1","traffic_size":5}]`), "json")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rows[0].number)
+	assert.Equal(t, 5, rows[0].TrafficSize)
+
+	_, err = parseImport(strings.NewReader(`[{"user":"user1"}]`), "json")
+	assert.Error(t, err)
+}
+
+func TestCheckImportRows(t *testing.T) {
+	row := func(number int, username, password string) importRow {
+		return importRow{
+			OcservUserImportRow: OcservUserImportRow{
+				Username:    username,
+				Password:    password,
+				Group:       "defaults",
+				TrafficType: "TotallyReceive",
+				TrafficSize: 10,
+				ExpireAt:    "2030-01-31",
+			},
+			number: number,
+		}
+	}
+	rows := []importRow{
+		row(1, "user1", ""),
+		row(2, "user1", "Str0ng-pass"),
+		row(3, "taken", ""),
+		row(4, "u", "weak"),
+		{OcservUserImportRow: OcservUserImportRow{Username: "user5", TrafficType: "Daily", TrafficSize: -1, ExpireAt: "31/01/2030"}, number: 5},
+		row(6, "user6", ""),
+		row(7, "user7", ""),
+	}
+	rows[5].Group = "sales"
+	rows[6].Group = "staff"
+	checkImportRows(rows, &utils.PasswordPolicy{MinLength: 8}, []string{"taken"}, []string{"sales"})
+	assert.Empty(t, rows[0].errs)
+	assert.Equal(t, []string{"username is duplicate of row 1"}, rows[1].errs)
+	assert.Equal(t, []string{"username already exists"}, rows[2].errs)
+	assert.Equal(t, []string{"username must be 3 to 16 characters", "password must be at least 8 characters long"}, rows[3].errs)
+	assert.Equal(t, []string{
+		"group is required",
+		"traffic_type must be one of Free, MonthlyTransmit, MonthlyReceive, TotallyTransmit, TotallyReceive",
+		"traffic_size must not be negative",
+		"expire_at must be a date like 2006-01-02",
+	}, rows[4].errs)
+	assert.Empty(t, rows[5].errs)
+	assert.Equal(t, []string{"group staff does not exist"}, rows[6].errs)
+
+	user, generated, err := rows[0].ocUser(&utils.PasswordPolicy{MinLength: 8})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, generated)
+	assert.Equal(t, generated, user.Password)
+	assert.Equal(t, "2030-01-31", user.ExpireAt.Format(importDateLayout))
+}
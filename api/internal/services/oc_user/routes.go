@@ -2,6 +2,7 @@ package ocUser
 
 import (
 	"api/internal/routes/middlewares"
+	"api/pkg/rbac"
 	"github.com/labstack/echo/v4"
 )
 
@@ -9,13 +10,26 @@ func Routes(e *echo.Group) {
 	controller := New()
 	group := e.Group("/ocserv/users", middlewares.IsAuthenticatedMiddleware())
 
-	group.GET("", controller.Users)
-	group.POST("", controller.Create)
-	group.GET("/:uid", controller.User)
-	group.PATCH("/:uid", controller.Update)
-	group.POST("/:uid/lock", controller.LockOrUnlock)
-	group.POST("/:uid/disconnect", controller.Disconnect)
-	group.DELETE("/:uid", controller.Delete)
-	group.GET("/:uid/statistics", controller.Statistics)
-	group.GET("/:uid/activities", controller.Activities)
+	read := middlewares.ActionMiddleware(rbac.OcUserRead)
+
+	group.GET("", controller.Users, read)
+	group.POST("", controller.Create, middlewares.ActionMiddleware(rbac.OcUserCreate))
+	group.POST("/import", controller.Import, middlewares.ActionMiddleware(rbac.OcUserCreate))
+	group.POST("/import/ocpasswd", controller.ImportOcpasswd, middlewares.IsAdminPermissionMiddleware())
+	group.GET("/ocpasswd/drift", controller.OcpasswdDrift, middlewares.IsAdminPermissionMiddleware())
+	group.POST("/ocpasswd/repair", controller.RepairOcpasswd, middlewares.IsAdminPermissionMiddleware())
+	group.GET("/operations", controller.Operations, middlewares.IsAdminPermissionMiddleware())
+	group.POST("/operations/:id/retry", controller.RetryOperation, middlewares.IsAdminPermissionMiddleware())
+	group.POST("/bulk", controller.Bulk, read)
+	group.GET("/export", controller.Export, read)
+	group.GET("/:uid", controller.User, read)
+	group.PATCH("/:uid", controller.Update, middlewares.ActionMiddleware(rbac.OcUserUpdate))
+	group.POST("/:uid/lock", controller.LockOrUnlock, middlewares.ActionMiddleware(rbac.OcUserLock))
+	group.POST("/:uid/disconnect", controller.Disconnect, middlewares.ActionMiddleware(rbac.OcUserDisconnect))
+	group.DELETE("/:uid", controller.Delete, middlewares.ActionMiddleware(rbac.OcUserDelete))
+	group.GET("/:uid/statistics", controller.Statistics, read)
+	group.GET("/:uid/activities", controller.Activities, read)
+	group.GET("/:uid/statistics/export", controller.ExportStatistics, read)
+	group.GET("/:uid/activities/export", controller.ExportActivities, read)
+	group.PATCH("/:uid/owner", controller.SetOwner, middlewares.IsAdminPermissionMiddleware())
 }
@@ -1,6 +1,7 @@
 package ocUser
 
 import (
+	"api/internal/repository"
 	"api/pkg/utils"
 	"github.com/mmtaee/go-oc-utils/models"
 )
@@ -22,3 +23,69 @@ type OcservUserCreateOrUpdateRequest struct {
 type OcservUserLockRequest struct {
 	Lock *bool `json:"lock" validate:"required"`
 }
+
+type OcservUserOwnerRequest struct {
+	OwnerUID string `json:"owner_uid" validate:"required"`
+}
+
+// OcservUserImportRow ocserv user of a csv or json import file. Password is generated when empty.
+type OcservUserImportRow struct {
+	Username    string `json:"username" example:"user1"`
+	Password    string `json:"password" example:""`
+	Group       string `json:"group" example:"defaults"`
+	TrafficType string `json:"traffic_type" example:"MonthlyTransmit" enums:"Free,MonthlyTransmit,MonthlyReceive,TotallyTransmit,TotallyReceive"`
+	TrafficSize int    `json:"traffic_size" example:"20"`
+	ExpireAt    string `json:"expire_at" example:"2025-12-31"`
+}
+
+// OcservUserImportResult row of an import file, with the generated password of created users
+type OcservUserImportResult struct {
+	Row      int      `json:"row"`
+	Username string   `json:"username"`
+	UID      string   `json:"uid,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type OcservUserImportReport struct {
+	DryRun  bool                     `json:"dry_run"`
+	Created []OcservUserImportResult `json:"created"`
+	Skipped []OcservUserImportResult `json:"skipped"`
+}
+
+// OcservUserBulkRequest action on the ocserv users of uids or of filter. Group is required by
+// set_group and days by extend_expiry.
+type OcservUserBulkRequest struct {
+	Action string                   `json:"action" validate:"required,oneof=lock unlock disconnect delete set_group extend_expiry"`
+	UIDs   []string                 `json:"uids" validate:"omitempty,max=1000,dive,required"`
+	Filter *repository.OcUserFilter `json:"filter"`
+	Group  string                   `json:"group"`
+	Days   int                      `json:"days" validate:"omitempty,max=3650"`
+}
+
+type OcservUserBulkResponse struct {
+	Results []repository.BulkResult `json:"results"`
+}
+
+type OcservUserExportRequest struct {
+	Format    string `query:"format" validate:"omitempty,oneof=csv ndjson xlsx"`
+	Passwords bool   `query:"passwords"`
+}
+
+type OcservUserRangeExportRequest struct {
+	Format string `query:"format" validate:"omitempty,oneof=csv ndjson xlsx"`
+	Start  string `query:"start" validate:"omitempty,datetime=2006-01-02"`
+	End    string `query:"end" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// OcpasswdImportRequest traffic of the ocserv users imported from ocpasswd, Free by default
+type OcpasswdImportRequest struct {
+	TrafficType string `json:"traffic_type" validate:"omitempty,oneof=Free MonthlyTransmit MonthlyReceive TotallyTransmit TotallyReceive" enums:"Free,MonthlyTransmit,MonthlyReceive,TotallyTransmit,TotallyReceive"`
+	TrafficSize int    `json:"traffic_size" validate:"omitempty,min=0"`
+	DryRun      bool   `json:"dry_run"`
+}
+
+// OcservUserOperationsRequest status of the listed operations, all that are not done when empty
+type OcservUserOperationsRequest struct {
+	Status string `query:"status" validate:"omitempty,oneof=pending running failed done"`
+}
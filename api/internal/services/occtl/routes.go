@@ -2,6 +2,7 @@ package occtl
 
 import (
 	"api/internal/routes/middlewares"
+	"api/pkg/rbac"
 	"github.com/labstack/echo/v4"
 )
 
@@ -10,13 +11,15 @@ func Routes(e *echo.Group) {
 
 	group := e.Group("/occtl", middlewares.IsAuthenticatedMiddleware())
 
-	group.POST("/reload", controller.Reload)
-	group.GET("/online", controller.OnlineUsers)
-	group.POST("/disconnect/:username", controller.Disconnect)
-	group.GET("/ip_bans", controller.ShowIPBans)
-	group.GET("/ip_bans/point", controller.ShowIPBansPoint)
-	group.POST("/unban", controller.UnBanIP)
-	group.GET("/status", controller.ShowStatus)
-	//group.GET("/iroutes", controller.ShowIRoutes)
-	group.GET("/users/:username", controller.ShowUser)
+	read := middlewares.ActionMiddleware(rbac.OcctlRead)
+
+	group.POST("/reload", controller.Reload, middlewares.ActionMiddleware(rbac.OcctlReload))
+	group.GET("/online", controller.OnlineUsers, read)
+	group.POST("/disconnect/:username", controller.Disconnect, middlewares.ActionMiddleware(rbac.OcctlDisconnect))
+	group.GET("/ip_bans", controller.ShowIPBans, read)
+	group.GET("/ip_bans/point", controller.ShowIPBansPoint, read)
+	group.POST("/unban", controller.UnBanIP, middlewares.ActionMiddleware(rbac.OcctlUnban))
+	group.GET("/status", controller.ShowStatus, read)
+	//group.GET("/iroutes", controller.ShowIRoutes, read)
+	group.GET("/users/:username", controller.ShowUser, read)
 }
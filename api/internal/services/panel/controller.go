@@ -4,6 +4,7 @@ import (
 	"api/internal/repository"
 	_ "api/internal/routes/middlewares"
 	"api/pkg/utils"
+	"context"
 	"github.com/labstack/echo/v4"
 	"github.com/mmtaee/go-oc-utils/models"
 	"net/http"
@@ -70,9 +71,61 @@ func (ctrl *Controller) UpdatePanelConfig(c echo.Context) error {
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
-	err := ctrl.panelRepo.UpdateConfig(c.Request().Context(), data.GoogleCaptchaSiteKey, data.GoogleCaptchaSecretKey)
-	if err != nil {
-		return utils.BadRequest(c, err)
+	// settings share this endpoint, so captcha keys are only changed when they are sent
+	if data.GoogleCaptchaSiteKey != nil || data.GoogleCaptchaSecretKey != nil {
+		err := ctrl.panelRepo.UpdateConfig(c.Request().Context(), data.GoogleCaptchaSiteKey, data.GoogleCaptchaSecretKey)
+		if err != nil {
+			return utils.BadRequest(c, err)
+		}
+	}
+	if data.TwoFactorRequired != nil || data.CaptchaProvider != nil || data.CaptchaVerifyURL != nil ||
+		data.LoginMaxFailures != nil || data.LoginLockout != nil || data.PasswordMinLength != nil ||
+		data.PasswordUpper != nil || data.PasswordLower != nil || data.PasswordDigit != nil ||
+		data.PasswordSymbol != nil || data.PasswordDenylist != nil || data.PasswordHistory != nil {
+		ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+		settings, err := ctrl.panelRepo.GetSettings(ctx)
+		if err != nil {
+			return utils.BadRequest(c, err)
+		}
+		if data.TwoFactorRequired != nil {
+			settings.TwoFactorRequired = *data.TwoFactorRequired
+		}
+		if data.CaptchaProvider != nil {
+			settings.CaptchaProvider = *data.CaptchaProvider
+		}
+		if data.CaptchaVerifyURL != nil {
+			settings.CaptchaVerifyURL = *data.CaptchaVerifyURL
+		}
+		if data.LoginMaxFailures != nil {
+			settings.LoginMaxFailures = *data.LoginMaxFailures
+		}
+		if data.LoginLockout != nil {
+			settings.LoginLockout = *data.LoginLockout
+		}
+		if data.PasswordMinLength != nil {
+			settings.PasswordMinLength = *data.PasswordMinLength
+		}
+		if data.PasswordUpper != nil {
+			settings.PasswordUpper = *data.PasswordUpper
+		}
+		if data.PasswordLower != nil {
+			settings.PasswordLower = *data.PasswordLower
+		}
+		if data.PasswordDigit != nil {
+			settings.PasswordDigit = *data.PasswordDigit
+		}
+		if data.PasswordSymbol != nil {
+			settings.PasswordSymbol = *data.PasswordSymbol
+		}
+		if data.PasswordDenylist != nil {
+			settings.PasswordDenylist = *data.PasswordDenylist
+		}
+		if data.PasswordHistory != nil {
+			settings.PasswordHistory = *data.PasswordHistory
+		}
+		if err = ctrl.panelRepo.UpdateSettings(ctx, settings); err != nil {
+			return utils.BadRequest(c, err)
+		}
 	}
 	return c.JSON(http.StatusOK, nil)
 }
@@ -95,10 +148,14 @@ func (ctrl *Controller) GetPanelInitConfig(c echo.Context) error {
 			GoogleCaptchaSiteKey: "",
 		})
 	}
-	return c.JSON(http.StatusOK, GetPanelConfigResponse{
+	response := GetPanelConfigResponse{
 		Init:                 config.Init,
 		GoogleCaptchaSiteKey: config.GoogleCaptchaSiteKey,
-	})
+	}
+	if settings, err := ctrl.panelRepo.GetSettings(c.Request().Context()); err == nil {
+		response.CaptchaProvider = settings.CaptchaProvider
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
 // GetPanelConfig Get Panel Config
@@ -118,8 +175,24 @@ func (ctrl *Controller) GetPanelConfig(c echo.Context) error {
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
+	settings, err := ctrl.panelRepo.GetSettings(c.Request().Context())
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
 	return c.JSON(http.StatusOK, GetFullPanelConfigResponse{
 		GoogleCaptchaSiteKey:   config.GoogleCaptchaSiteKey,
 		GoogleCaptchaSecretKey: config.GoogleCaptchaSecretKey,
+		TwoFactorRequired:      settings.TwoFactorRequired,
+		CaptchaProvider:        settings.CaptchaProvider,
+		CaptchaVerifyURL:       settings.CaptchaVerifyURL,
+		LoginMaxFailures:       settings.LoginMaxFailures,
+		LoginLockout:           settings.LoginLockout,
+		PasswordMinLength:      settings.PasswordMinLength,
+		PasswordUpper:          settings.PasswordUpper,
+		PasswordLower:          settings.PasswordLower,
+		PasswordDigit:          settings.PasswordDigit,
+		PasswordSymbol:         settings.PasswordSymbol,
+		PasswordDenylist:       settings.PasswordDenylist,
+		PasswordHistory:        settings.PasswordHistory,
 	})
 }
@@ -1,18 +1,43 @@
 package panel
 
 type UpdateSiteConfigRequest struct {
-	GoogleCaptchaSecretKey string `json:"google_captcha_secret_key" validate:"omitempty"`
-	GoogleCaptchaSiteKey   string `json:"google_captcha_site_key" validate:"omitempty"`
+	GoogleCaptchaSecretKey *string `json:"google_captcha_secret_key" validate:"omitempty"`
+	GoogleCaptchaSiteKey   *string `json:"google_captcha_site_key" validate:"omitempty"`
+	TwoFactorRequired      *bool   `json:"two_factor_required" validate:"omitempty"`
+	CaptchaProvider        *string `json:"captcha_provider" validate:"omitempty,oneof=recaptcha hcaptcha turnstile"`
+	CaptchaVerifyURL       *string `json:"captcha_verify_url" validate:"omitempty,url"`
+	LoginMaxFailures       *int    `json:"login_max_failures" validate:"omitempty,min=1"`
+	LoginLockout           *int    `json:"login_lockout" validate:"omitempty,min=1"`
+	PasswordMinLength      *int    `json:"password_min_length" validate:"omitempty,min=1,max=16"`
+	PasswordUpper          *bool   `json:"password_upper" validate:"omitempty"`
+	PasswordLower          *bool   `json:"password_lower" validate:"omitempty"`
+	PasswordDigit          *bool   `json:"password_digit" validate:"omitempty"`
+	PasswordSymbol         *bool   `json:"password_symbol" validate:"omitempty"`
+	PasswordDenylist       *string `json:"password_denylist" validate:"omitempty" example:"company\nvpn2024"`
+	PasswordHistory        *int    `json:"password_history" validate:"omitempty,min=0,max=24"`
 }
 
 type GetPanelConfigResponse struct {
 	Init                 bool   `json:"init"`
 	GoogleCaptchaSiteKey string `json:"google_captcha_site_key"`
+	CaptchaProvider      string `json:"captcha_provider"`
 }
 
 type GetFullPanelConfigResponse struct {
 	GoogleCaptchaSecretKey string `json:"google_captcha_secret_key"`
 	GoogleCaptchaSiteKey   string `json:"google_captcha_site_key"`
+	TwoFactorRequired      bool   `json:"two_factor_required"`
+	CaptchaProvider        string `json:"captcha_provider"`
+	CaptchaVerifyURL       string `json:"captcha_verify_url"`
+	LoginMaxFailures       int    `json:"login_max_failures"`
+	LoginLockout           int    `json:"login_lockout"`
+	PasswordMinLength      int    `json:"password_min_length"`
+	PasswordUpper          bool   `json:"password_upper"`
+	PasswordLower          bool   `json:"password_lower"`
+	PasswordDigit          bool   `json:"password_digit"`
+	PasswordSymbol         bool   `json:"password_symbol"`
+	PasswordDenylist       string `json:"password_denylist"`
+	PasswordHistory        int    `json:"password_history"`
 }
 
 type CreateSiteConfigRequest struct {
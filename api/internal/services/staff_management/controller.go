@@ -1,26 +1,52 @@
 package staffManagement
 
 import (
+	"api/internal/entities"
 	"api/internal/repository"
 	_ "api/internal/routes/middlewares"
+	"api/pkg/rbac"
 	"api/pkg/utils"
+	"context"
+	"errors"
 	"github.com/labstack/echo/v4"
 	"github.com/mmtaee/go-oc-utils/models"
 	"net/http"
+	"strconv"
 )
 
 type Controller struct {
-	validator utils.CustomValidatorInterface
-	staffRepo repository.StaffRepositoryInterface
+	validator     utils.CustomValidatorInterface
+	staffRepo     repository.StaffRepositoryInterface
+	twoFactorRepo repository.TwoFactorRepositoryInterface
+	sessionRepo   repository.SessionRepositoryInterface
+	lockoutRepo   repository.LockoutRepositoryInterface
+	panelRepo     repository.PanelConfigRepositoryInterface
+	roleRepo      repository.RoleRepositoryInterface
+	quotaRepo     repository.QuotaRepositoryInterface
 }
 
 func New() *Controller {
 	return &Controller{
-		validator: utils.NewCustomValidator(),
-		staffRepo: repository.NewStaffRepository(),
+		validator:     utils.NewCustomValidator(),
+		staffRepo:     repository.NewStaffRepository(),
+		twoFactorRepo: repository.NewTwoFactorRepository(),
+		sessionRepo:   repository.NewSessionRepository(),
+		lockoutRepo:   repository.NewLockoutRepository(),
+		panelRepo:     repository.NewPanelConfigRepository(),
+		roleRepo:      repository.NewRoleRepository(),
+		quotaRepo:     repository.NewQuotaRepository(),
 	}
 }
 
+// validatePassword check password of staff against the password policy of panel settings
+func (ctrl *Controller) validatePassword(c echo.Context, password string) interface{} {
+	policy, err := ctrl.panelRepo.PasswordPolicy(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return ctrl.validator.ValidatePassword("password", password, policy)
+}
+
 // Staffs List of Staffs
 //
 // @Summary      Staffs
@@ -77,7 +103,7 @@ func (ctrl *Controller) StaffPermission(c echo.Context) error {
 // CreateStaff Create Staff
 //
 // @Summary      Create Staff
-// @Description  Create Staff with Permission
+// @Description  Create Staff with Permission. Password must match the password policy of panel settings
 // @Tags         Staff Management
 // @Accept       json
 // @Produce      json
@@ -93,6 +119,9 @@ func (ctrl *Controller) CreateStaff(c echo.Context) error {
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
+	if err := ctrl.validatePassword(c, data.User.Password); err != nil {
+		return utils.BadRequest(c, err)
+	}
 
 	pass := utils.NewPassword(data.User.Password)
 	staff := models.User{
@@ -144,7 +173,7 @@ func (ctrl *Controller) UpdateStaffPermission(c echo.Context) error {
 // UpdateStaffPassword Update Staff Password
 //
 // @Summary      Update Staff Password
-// @Description  Update Staff Password
+// @Description  Update Staff Password and revoke all sessions of staff. Password must match the password policy and not be one of the last passwords of staff
 // @Tags         Staff Management
 // @Accept       json
 // @Produce      json
@@ -161,8 +190,10 @@ func (ctrl *Controller) UpdateStaffPassword(c echo.Context) error {
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
-	pass := utils.NewPassword(data.Password)
-	err := ctrl.staffRepo.UpdateStaffPassword(c.Request().Context(), c.Param("uid"), pass.Hash, pass.Salt)
+	if err := ctrl.validatePassword(c, data.Password); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	err := ctrl.staffRepo.UpdateStaffPassword(c.Request().Context(), c.Param("uid"), data.Password)
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
@@ -190,3 +221,494 @@ func (ctrl *Controller) DeleteStaff(c echo.Context) error {
 	}
 	return c.JSON(http.StatusNoContent, nil)
 }
+
+// ResetStaffTwoFactor Reset Staff Two Factor
+//
+// @Summary      Reset Staff Two Factor
+// @Description  Remove two factor and recovery codes of staff that lost the authenticator
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      204  {object} nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/two_factor [delete]
+func (ctrl *Controller) ResetStaffTwoFactor(c echo.Context) error {
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	err := ctrl.twoFactorRepo.Reset(ctx, c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// StaffSessions Sessions of Staff
+//
+// @Summary      Staff Sessions
+// @Description  List of active sessions of Staff
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      200  {array} repository.Session
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/sessions [get]
+func (ctrl *Controller) StaffSessions(c echo.Context) error {
+	sessions, err := ctrl.sessionRepo.StaffSessions(c.Request().Context(), c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeStaffSession Revoke Session of Staff
+//
+// @Summary      Revoke Staff Session
+// @Description  Revoke a session of Staff by id
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Param 		 id path int true "Session ID"
+// @Success      204  {object} nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/sessions/:id [delete]
+func (ctrl *Controller) RevokeStaffSession(c echo.Context) error {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.BadRequest(c, errors.New("invalid session id"))
+	}
+	err = ctrl.sessionRepo.RevokeStaff(c.Request().Context(), c.Param("uid"), uint(sessionID))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// RevokeStaffSessions Revoke All Sessions of Staff
+//
+// @Summary      Revoke Staff Sessions
+// @Description  Revoke all sessions of Staff
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      204  {object} nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/sessions [delete]
+func (ctrl *Controller) RevokeStaffSessions(c echo.Context) error {
+	err := ctrl.sessionRepo.RevokeStaffAll(c.Request().Context(), c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// Lockouts List of Locked Logins
+//
+// @Summary      Login Lockouts
+// @Description  List of usernames and ips locked by failed login attempts
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {array} entities.LoginFailure
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/lockouts [get]
+func (ctrl *Controller) Lockouts(c echo.Context) error {
+	lockouts, err := ctrl.lockoutRepo.Lockouts(c.Request().Context())
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, lockouts)
+}
+
+// ClearLockout Clear Locked Login
+//
+// @Summary      Clear Login Lockout
+// @Description  Clear failed login attempts and lockout of a username or ip by id
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 id path int true "Lockout ID"
+// @Success      204  {object} nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/lockouts/:id [delete]
+func (ctrl *Controller) ClearLockout(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.BadRequest(c, errors.New("invalid lockout id"))
+	}
+	if err = ctrl.lockoutRepo.Clear(c.Request().Context(), uint(id)); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// ClearLockouts Clear All Locked Logins
+//
+// @Summary      Clear Login Lockouts
+// @Description  Clear failed login attempts and lockouts of all usernames and ips
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      204  {object} nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/lockouts [delete]
+func (ctrl *Controller) ClearLockouts(c echo.Context) error {
+	if err := ctrl.lockoutRepo.ClearAll(c.Request().Context()); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// RoleActions List of Actions
+//
+// @Summary      Role Actions
+// @Description  List of actions that can be granted by roles
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {object} ActionsResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/roles/actions [get]
+func (ctrl *Controller) RoleActions(c echo.Context) error {
+	return c.JSON(http.StatusOK, ActionsResponse{Actions: rbac.Actions})
+}
+
+// Roles List of Roles
+//
+// @Summary      Roles
+// @Description  List of built-in and custom roles. Built-in roles hold all actions of a permission and can not be changed
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {array} entities.Role
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/roles [get]
+func (ctrl *Controller) Roles(c echo.Context) error {
+	roles, err := ctrl.roleRepo.Roles(c.Request().Context())
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole Create Role
+//
+// @Summary      Create Role
+// @Description  Create a custom role with a set of actions
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request body  RoleRequest true "Role body"
+// @Success      201  {object} entities.Role
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/roles [post]
+func (ctrl *Controller) CreateRole(c echo.Context) error {
+	var data RoleRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	role := entities.Role{
+		Name:        data.Name,
+		Description: data.Description,
+		Actions:     data.Actions,
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	if err := ctrl.roleRepo.CreateRole(ctx, &role); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole Update Role
+//
+// @Summary      Update Role
+// @Description  Update name, description and actions of a custom role. Staff with the role get the new actions on their next request
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 id path int true "Role ID"
+// @Param        request body  RoleRequest true "Role body"
+// @Success      200  {object} entities.Role
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/roles/:id [patch]
+func (ctrl *Controller) UpdateRole(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.BadRequest(c, errors.New("invalid role id"))
+	}
+	var data RoleRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	role, err := ctrl.roleRepo.UpdateRole(ctx, uint(id), &entities.Role{
+		Name:        data.Name,
+		Description: data.Description,
+		Actions:     data.Actions,
+	})
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole Delete Role
+//
+// @Summary      Delete Role
+// @Description  Delete a custom role and remove it from staffs
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 id path int true "Role ID"
+// @Success      204  {object} nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/roles/:id [delete]
+func (ctrl *Controller) DeleteRole(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.BadRequest(c, errors.New("invalid role id"))
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	if err = ctrl.roleRepo.DeleteRole(ctx, uint(id)); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// StaffRoles Roles of Staff
+//
+// @Summary      Staff Roles
+// @Description  List of roles assigned to Staff
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      200  {array} entities.Role
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/roles [get]
+func (ctrl *Controller) StaffRoles(c echo.Context) error {
+	roles, err := ctrl.roleRepo.StaffRoles(c.Request().Context(), c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+// SetStaffRoles Set Roles of Staff
+//
+// @Summary      Set Staff Roles
+// @Description  Replace roles of Staff. Permission flags of Staff follow the assigned built-in roles
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Param        request body  SetStaffRolesRequest true "Staff roles body"
+// @Success      200  {array} entities.Role
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/roles [put]
+func (ctrl *Controller) SetStaffRoles(c echo.Context) error {
+	var data SetStaffRolesRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	roles, err := ctrl.roleRepo.SetStaffRoles(ctx, c.Param("uid"), data.Roles)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+// StaffQuota Quota of Staff
+//
+// @Summary      Staff Quota
+// @Description  Limits of the ocserv users Staff provisions with the current usage. Traffic is in GB
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      200  {object} repository.Quota
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/quota [get]
+func (ctrl *Controller) StaffQuota(c echo.Context) error {
+	quota, err := ctrl.quotaRepo.Quota(c.Request().Context(), c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, quota)
+}
+
+// SetStaffQuota Set Quota of Staff
+//
+// @Summary      Set Staff Quota
+// @Description  Replace limits of Staff. Omitted limits and empty groups are not limited. Existing ocserv users over the new limits are kept
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Param        request body  StaffQuotaRequest true "Staff quota body"
+// @Success      200  {object} repository.Quota
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/quota [put]
+func (ctrl *Controller) SetStaffQuota(c echo.Context) error {
+	var data StaffQuotaRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	quota, err := ctrl.quotaRepo.SetQuota(ctx, c.Param("uid"), &entities.StaffQuota{
+		MaxUsers:      data.MaxUsers,
+		MaxTraffic:    data.MaxTraffic,
+		MaxExpireDays: data.MaxExpireDays,
+		Groups:        data.Groups,
+	})
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, quota)
+}
+
+// StaffStatus Account Status of Staff
+//
+// @Summary      Staff Status
+// @Description  Account status of Staff. Disabled or expired staffs can not login
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      200  {object} entities.UserStatus
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/status [get]
+func (ctrl *Controller) StaffStatus(c echo.Context) error {
+	status, err := ctrl.staffRepo.StaffStatus(c.Request().Context(), c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// DisableStaff Disable Staff
+//
+// @Summary      Disable Staff
+// @Description  Disable Staff and revoke all sessions of staff. Api keys of staff are rejected until staff is enabled
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      200  {object} entities.UserStatus
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/disable [post]
+func (ctrl *Controller) DisableStaff(c echo.Context) error {
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	status, err := ctrl.staffRepo.DisableStaff(ctx, c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// EnableStaff Enable Staff
+//
+// @Summary      Enable Staff
+// @Description  Enable a disabled Staff. Account expiry is not changed
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Success      200  {object} entities.UserStatus
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/enable [post]
+func (ctrl *Controller) EnableStaff(c echo.Context) error {
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	status, err := ctrl.staffRepo.EnableStaff(ctx, c.Param("uid"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// SetStaffExpiry Set Account Expiry of Staff
+//
+// @Summary      Set Staff Expiry
+// @Description  Set the account expiry of Staff, null removes it. Sessions of staff end with the account
+// @Tags         Staff Management
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 uid path string true "User UID"
+// @Param        request body  StaffExpiryRequest true "Staff expiry body"
+// @Success      200  {object} entities.UserStatus
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Failure		 403 {object} nil
+// @Router       /api/v1/staffs/:uid/expiry [patch]
+func (ctrl *Controller) SetStaffExpiry(c echo.Context) error {
+	var data StaffExpiryRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	status, err := ctrl.staffRepo.SetStaffExpiry(ctx, c.Param("uid"), data.ExpireAt)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, status)
+}
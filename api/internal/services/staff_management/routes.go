@@ -14,9 +14,29 @@ func Routes(e *echo.Group) {
 	)
 	staffGroup.GET("", controller.Staffs)
 	staffGroup.POST("", controller.CreateStaff)
+	staffGroup.GET("/lockouts", controller.Lockouts)
+	staffGroup.DELETE("/lockouts", controller.ClearLockouts)
+	staffGroup.DELETE("/lockouts/:id", controller.ClearLockout)
+	staffGroup.GET("/roles", controller.Roles)
+	staffGroup.POST("/roles", controller.CreateRole)
+	staffGroup.GET("/roles/actions", controller.RoleActions)
+	staffGroup.PATCH("/roles/:id", controller.UpdateRole)
+	staffGroup.DELETE("/roles/:id", controller.DeleteRole)
 	staffGroup.POST("/:uid", controller.UpdateStaffPassword)
 	staffGroup.DELETE("/:uid", controller.DeleteStaff)
 	staffGroup.GET("/:uid/permission", controller.StaffPermission)
 	staffGroup.PATCH("/:uid/permission", controller.UpdateStaffPermission)
+	staffGroup.DELETE("/:uid/two_factor", controller.ResetStaffTwoFactor)
+	staffGroup.GET("/:uid/status", controller.StaffStatus)
+	staffGroup.POST("/:uid/disable", controller.DisableStaff)
+	staffGroup.POST("/:uid/enable", controller.EnableStaff)
+	staffGroup.PATCH("/:uid/expiry", controller.SetStaffExpiry)
+	staffGroup.GET("/:uid/sessions", controller.StaffSessions)
+	staffGroup.DELETE("/:uid/sessions", controller.RevokeStaffSessions)
+	staffGroup.DELETE("/:uid/sessions/:id", controller.RevokeStaffSession)
+	staffGroup.GET("/:uid/roles", controller.StaffRoles)
+	staffGroup.PUT("/:uid/roles", controller.SetStaffRoles)
+	staffGroup.GET("/:uid/quota", controller.StaffQuota)
+	staffGroup.PUT("/:uid/quota", controller.SetStaffQuota)
 
 }
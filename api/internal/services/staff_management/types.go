@@ -1,8 +1,10 @@
 package staffManagement
 
 import (
+	"api/pkg/rbac"
 	"api/pkg/utils"
 	"github.com/mmtaee/go-oc-utils/models"
+	"time"
 )
 
 type StaffsResponse struct {
@@ -35,3 +37,28 @@ type UpdateStaffPermissionRequest struct {
 type UpdateStaffPasswordRequest struct {
 	Password string `json:"password" validate:"required,min=2,max=16" example:"doe123456"`
 }
+
+type RoleRequest struct {
+	Name        string   `json:"name" validate:"required,min=2,max=32" example:"support"`
+	Description string   `json:"description" validate:"max=255" example:"view and disconnect ocserv users"`
+	Actions     []string `json:"actions" validate:"required,min=1,max=64,dive,required" example:"oc_user.read,oc_user.disconnect"`
+}
+
+type SetStaffRolesRequest struct {
+	Roles []uint `json:"roles" validate:"required,max=64" example:"1,6"`
+}
+
+type ActionsResponse struct {
+	Actions []rbac.Action `json:"actions"`
+}
+
+type StaffQuotaRequest struct {
+	MaxUsers      *int     `json:"max_users" validate:"omitempty,min=0" example:"50"`
+	MaxTraffic    *int     `json:"max_traffic" validate:"omitempty,min=0" example:"500"`
+	MaxExpireDays *int     `json:"max_expire_days" validate:"omitempty,min=1" example:"90"`
+	Groups        []string `json:"groups" validate:"omitempty,max=64,dive,required" example:"defaults,premium"`
+}
+
+type StaffExpiryRequest struct {
+	ExpireAt *time.Time `json:"expire_at" example:"2025-01-01T00:00:00Z"`
+}
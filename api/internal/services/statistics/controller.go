@@ -4,6 +4,7 @@ import (
 	"api/internal/repository"
 	_ "api/internal/routes/middlewares"
 	"api/pkg/utils"
+	"context"
 	"errors"
 	"github.com/labstack/echo/v4"
 	"net/http"
@@ -24,7 +25,7 @@ func New() *Controller {
 // Statistics Year and Month Statistics
 //
 // @Summary      Year and Month Statistics
-// @Description  Year and Month Statistics by given year and month as int
+// @Description  Year and Month Statistics by given year and month as int. Staff that are not admin get the traffic of their own ocserv users
 // @Tags         Statistics
 // @Accept       json
 // @Produce      json
@@ -58,11 +59,12 @@ func (ctrl *Controller) Statistics(c echo.Context) error {
 			return utils.BadRequest(c, errors.New("invalid year"))
 		}
 	}
-	statsMonth, err := ctrl.statistics.Month(c.Request().Context(), year, month)
+	ctx := context.WithValue(c.Request().Context(), "ownerID", c.Get("ownerID"))
+	statsMonth, err := ctrl.statistics.Month(ctx, year, month)
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
-	statsYear, err := ctrl.statistics.Year(c.Request().Context(), year)
+	statsYear, err := ctrl.statistics.Year(ctx, year)
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
@@ -2,11 +2,12 @@ package statistics
 
 import (
 	"api/internal/routes/middlewares"
+	"api/pkg/rbac"
 	"github.com/labstack/echo/v4"
 )
 
 func Routes(e *echo.Group) {
 	controller := New()
 	group := e.Group("/statistics", middlewares.IsAuthenticatedMiddleware())
-	group.GET("", controller.Statistics)
+	group.GET("", controller.Statistics, middlewares.ActionMiddleware(rbac.StatisticRead))
 }
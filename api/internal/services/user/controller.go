@@ -1,8 +1,10 @@
 package user
 
 import (
+	_ "api/internal/entities"
 	"api/internal/repository"
 	_ "api/internal/routes/middlewares"
+	"api/pkg/captcha"
 	"api/pkg/config"
 	"api/pkg/utils"
 	"context"
@@ -10,24 +12,72 @@ import (
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/mmtaee/go-oc-utils/logger"
+	"gorm.io/gorm"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Controller struct {
-	validator utils.CustomValidatorInterface
-	userRepo  *repository.UserRepository
+	validator   utils.CustomValidatorInterface
+	userRepo    *repository.UserRepository
+	panelRepo   repository.PanelConfigRepositoryInterface
+	sessionRepo repository.SessionRepositoryInterface
+	apiKeyRepo  repository.ApiKeyRepositoryInterface
 }
 
 func New() *Controller {
 	return &Controller{
-		validator: utils.NewCustomValidator(),
-		userRepo:  repository.NewUserRepository(),
+		validator:   utils.NewCustomValidator(),
+		userRepo:    repository.NewUserRepository(),
+		panelRepo:   repository.NewPanelConfigRepository(),
+		sessionRepo: repository.NewSessionRepository(),
+		apiKeyRepo:  repository.NewApiKeyRepository(),
 	}
 }
 
+// clientContext add client ip and user agent to request context to save with new sessions and auth events
+func clientContext(c echo.Context) context.Context {
+	ctx := context.WithValue(c.Request().Context(), "ip", c.RealIP())
+	return context.WithValue(ctx, "userAgent", c.Request().UserAgent())
+}
+
+// loginError respond too many requests with Retry-After header when login is blocked by failed attempts
+func loginError(c echo.Context, err error) error {
+	var blocked *repository.LoginBlockedError
+	if errors.As(err, &blocked) {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(blocked.RetryAfterSeconds()))
+		return c.JSON(http.StatusTooManyRequests, utils.ErrorResponse{Error: blocked.Error()})
+	}
+	return utils.BadRequest(c, err)
+}
+
+// verifyCaptcha verify login captcha when a captcha secret key is set in panel config. Before
+// the panel is initialized there is no config, so captcha is not configured.
+func (ctrl *Controller) verifyCaptcha(c echo.Context, token string) error {
+	config, err := ctrl.panelRepo.GetConfig(c.Request().Context())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if config.GoogleCaptchaSecretKey == "" {
+		return nil
+	}
+	settings, err := ctrl.panelRepo.GetSettings(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	verifier, err := captcha.New(settings.CaptchaProvider, config.GoogleCaptchaSecretKey, settings.CaptchaVerifyURL)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(c.Request().Context(), token, c.RealIP())
+}
+
 // CreateSuperUser Create Superuser account
 //
 // @Summary      Create Superuser
@@ -77,7 +127,7 @@ func (ctrl *Controller) CreateSuperUser(c echo.Context) error {
 		return utils.BadRequest(c, err)
 	}
 
-	token, err := ctrl.userRepo.CreateToken(c.Request().Context(), user.ID, time.Now().Add(time.Hour*24*30))
+	token, err := ctrl.userRepo.CreateToken(clientContext(c), user.ID, time.Now().Add(time.Hour*24*30))
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
@@ -87,7 +137,7 @@ func (ctrl *Controller) CreateSuperUser(c echo.Context) error {
 // Login Admin or Staff login
 //
 // @Summary      Login Admin or Staff User
-// @Description  Login Admin or Staff User to get Token for request
+// @Description  Login Admin or Staff User to get Token for request. Captcha is required when a captcha secret key is set in panel config
 // @Tags         Site User
 // @Accept       json
 // @Produce      json
@@ -96,6 +146,7 @@ func (ctrl *Controller) CreateSuperUser(c echo.Context) error {
 // @Success      200  {object}  LoginResponse
 // @Failure      400 {object} utils.ErrorResponse
 // @Failure      401 {object} middlewares.Unauthorized
+// @Failure      429 {object} utils.ErrorResponse
 // @Router       /api/v1/user/login [post]
 func (ctrl *Controller) Login(c echo.Context) error {
 	var (
@@ -104,11 +155,130 @@ func (ctrl *Controller) Login(c echo.Context) error {
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
-	token, err := ctrl.userRepo.Login(c.Request().Context(), data.Username, data.Password, data.RememberMe)
+	if err := ctrl.verifyCaptcha(c, data.Captcha); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	result, err := ctrl.userRepo.Login(clientContext(c), data.Username, data.Password, data.RememberMe)
 	if err != nil {
+		return loginError(c, err)
+	}
+	return c.JSON(http.StatusOK, LoginResponse{
+		Token:                  result.Token,
+		Challenge:              result.Challenge,
+		TwoFactorRequired:      result.Challenge != "",
+		TwoFactorSetupRequired: result.TwoFactorSetupRequired,
+	})
+}
+
+// LoginTwoFactor Exchange login challenge with token
+//
+// @Summary      Login second step with two factor code
+// @Description  Exchange the login challenge with a TOTP code or a recovery code to get Token. When two factor is mandatory and setup is pending, the code confirms the setup and recovery codes are returned
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        request    body  TwoFactorLoginRequest   true "challenge and code"
+// @Success      200  {object}  TwoFactorLoginResponse
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      429 {object} utils.ErrorResponse
+// @Router       /api/v1/user/login/two_factor [post]
+func (ctrl *Controller) LoginTwoFactor(c echo.Context) error {
+	var data TwoFactorLoginRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
-	return c.JSON(http.StatusOK, LoginResponse{Token: token})
+	result, err := ctrl.userRepo.LoginTwoFactor(clientContext(c), data.Challenge, data.Code, data.RecoveryCode)
+	if err != nil {
+		return loginError(c, err)
+	}
+	return c.JSON(http.StatusOK, TwoFactorLoginResponse{
+		Token:         result.Token,
+		RecoveryCodes: result.RecoveryCodes,
+	})
+}
+
+// LoginTwoFactorSetup Start mandatory two factor setup with login challenge
+//
+// @Summary      Two factor setup in login
+// @Description  Create TOTP secret and provisioning uri for a user that must set up two factor before login
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        request    body  TwoFactorLoginSetupRequest   true "login challenge"
+// @Success      200  {object}  repository.TwoFactorSetup
+// @Failure      400 {object} utils.ErrorResponse
+// @Router       /api/v1/user/login/two_factor/setup [post]
+func (ctrl *Controller) LoginTwoFactorSetup(c echo.Context) error {
+	var data TwoFactorLoginSetupRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	setup, err := ctrl.userRepo.LoginTwoFactorSetup(c.Request().Context(), data.Challenge)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, setup)
+}
+
+// OIDCProviders List single sign-on providers
+//
+// @Summary      List single sign-on providers
+// @Description  List names of the OpenID Connect providers that staff can login with
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  OIDCProvidersResponse
+// @Router       /api/v1/user/oidc [get]
+func (ctrl *Controller) OIDCProviders(c echo.Context) error {
+	providers := ctrl.userRepo.OIDC.Providers()
+	if providers == nil {
+		providers = []string{}
+	}
+	return c.JSON(http.StatusOK, OIDCProvidersResponse{Providers: providers})
+}
+
+// OIDCLogin Start single sign-on login
+//
+// @Summary      Start single sign-on login
+// @Description  Create the login state and return the authorization url of the provider. The browser is redirected to the url and the provider redirects back with code and state, which are sent to the callback
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        provider path string true "provider name"
+// @Success      200  {object}  OIDCLoginResponse
+// @Failure      400 {object} utils.ErrorResponse
+// @Router       /api/v1/user/oidc/{provider} [get]
+func (ctrl *Controller) OIDCLogin(c echo.Context) error {
+	authURL, err := ctrl.userRepo.OIDC.Begin(c.Request().Context(), c.Param("provider"))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, OIDCLoginResponse{AuthURL: authURL})
+}
+
+// OIDCCallback Finish single sign-on login
+//
+// @Summary      Finish single sign-on login
+// @Description  Exchange code and state of the provider redirect with Token. Staff user is created or updated with admin status and permissions of the provider groups
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        provider path string true "provider name"
+// @Param        request    body  OIDCCallbackRequest   true "code and state of provider redirect"
+// @Success      200  {object}  LoginResponse
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      429 {object} utils.ErrorResponse
+// @Router       /api/v1/user/oidc/{provider}/callback [post]
+func (ctrl *Controller) OIDCCallback(c echo.Context) error {
+	var data OIDCCallbackRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	result, err := ctrl.userRepo.LoginOIDC(clientContext(c), c.Param("provider"), data.State, data.Code)
+	if err != nil {
+		return loginError(c, err)
+	}
+	return c.JSON(http.StatusOK, LoginResponse{Token: result.Token})
 }
 
 // Logout Admin or Staff logout
@@ -124,7 +294,7 @@ func (ctrl *Controller) Login(c echo.Context) error {
 // @Failure      401 {object} middlewares.Unauthorized
 // @Router       /api/v1/user/logout [delete]
 func (ctrl *Controller) Logout(c echo.Context) error {
-	ctx := context.WithValue(c.Request().Context(), "token", c.Get("token"))
+	ctx := context.WithValue(clientContext(c), "token", c.Get("token"))
 	ctx = context.WithValue(ctx, "userID", c.Get("userID"))
 	err := ctrl.userRepo.Logout(ctx)
 	if err != nil {
@@ -133,10 +303,62 @@ func (ctrl *Controller) Logout(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// Me Current user
+//
+// @Summary      Current user
+// @Description  Current Admin or Staff User with effective permissions, expiry of the current session, two factor status and profile. Admins have all permissions
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {object}  repository.Me
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/me [get]
+func (ctrl *Controller) Me(c echo.Context) error {
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	ctx = context.WithValue(ctx, "token", c.Get("token"))
+	me, err := ctrl.userRepo.Me(ctx)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, me)
+}
+
+// UpdateMe Update current user profile
+//
+// @Summary      Update current user profile
+// @Description  Update display name, email and preferred language of the current Admin or Staff User. Omitted fields are not changed and empty strings clear them
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request    body  UpdateProfileRequest   true "profile fields"
+// @Success      200  {object}  entities.UserProfile
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/me [patch]
+func (ctrl *Controller) UpdateMe(c echo.Context) error {
+	var data UpdateProfileRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	profile, err := ctrl.userRepo.UpdateProfile(ctx, &repository.ProfileUpdate{
+		DisplayName: data.DisplayName,
+		Email:       data.Email,
+		Language:    data.Language,
+	})
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, profile)
+}
+
 // ChangePassword Admin or Staff change password
 //
 // @Summary      ChangePassword Admin or Staff User change password
-// @Description  ChangePassword Admin or Staff User change password with send old and new password
+// @Description  ChangePassword Admin or Staff User change password with send old and new password. New password must match the password policy and not be one of the last passwords. Other sessions are revoked
 // @Tags         Site User
 // @Accept       json
 // @Produce      json
@@ -151,10 +373,259 @@ func (ctrl *Controller) ChangePassword(c echo.Context) error {
 	if err := ctrl.validator.Validate(c, &data); err != nil {
 		return utils.BadRequest(c, err)
 	}
-	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
-	err := ctrl.userRepo.ChangePassword(ctx, data.OldPassword, data.NewPassword)
+	policy, err := ctrl.panelRepo.PasswordPolicy(c.Request().Context())
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	if err := ctrl.validator.ValidatePassword("new_password", data.NewPassword, policy); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := context.WithValue(clientContext(c), "userID", c.Get("userID"))
+	ctx = context.WithValue(ctx, "token", c.Get("token"))
+	err = ctrl.userRepo.ChangePassword(ctx, data.OldPassword, data.NewPassword)
 	if err != nil {
 		return utils.BadRequest(c, err)
 	}
 	return nil
 }
+
+func currentUserID(c echo.Context) uint {
+	userID, _ := strconv.Atoi(c.Get("userID").(string))
+	return uint(userID)
+}
+
+// TwoFactorSetup Start two factor setup
+//
+// @Summary      Two factor setup
+// @Description  Create TOTP secret and provisioning uri to show as QR code. Two factor is enabled after confirm
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {object}  repository.TwoFactorSetup
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/two_factor/setup [post]
+func (ctrl *Controller) TwoFactorSetup(c echo.Context) error {
+	setup, err := ctrl.userRepo.TwoFactor.Setup(c.Request().Context(), currentUserID(c))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, setup)
+}
+
+// TwoFactorConfirm Confirm two factor setup
+//
+// @Summary      Two factor confirm
+// @Description  Enable two factor with the first TOTP code and get single use recovery codes
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request    body  TwoFactorCodeRequest   true "TOTP code"
+// @Success      200  {object}  RecoveryCodesResponse
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/two_factor/confirm [post]
+func (ctrl *Controller) TwoFactorConfirm(c echo.Context) error {
+	var data TwoFactorCodeRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	codes, err := ctrl.userRepo.TwoFactor.Confirm(c.Request().Context(), currentUserID(c), data.Code)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// TwoFactorRecoveryCodes Regenerate recovery codes
+//
+// @Summary      Two factor recovery codes
+// @Description  Replace all recovery codes with new ones
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request    body  TwoFactorCodeRequest   true "TOTP code"
+// @Success      200  {object}  RecoveryCodesResponse
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/two_factor/recovery_codes [post]
+func (ctrl *Controller) TwoFactorRecoveryCodes(c echo.Context) error {
+	var data TwoFactorCodeRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	codes, err := ctrl.userRepo.TwoFactor.RecoveryCodes(c.Request().Context(), currentUserID(c), data.Code)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// TwoFactorDisable Disable two factor
+//
+// @Summary      Two factor disable
+// @Description  Disable two factor with a TOTP code. Not allowed when two factor is mandatory
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request    body  TwoFactorDisableRequest   true "TOTP code"
+// @Success      204  {object}  nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/two_factor [delete]
+func (ctrl *Controller) TwoFactorDisable(c echo.Context) error {
+	var data TwoFactorDisableRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	err := ctrl.userRepo.DisableTwoFactor(c.Request().Context(), currentUserID(c), data.Code)
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Sessions List of active sessions
+//
+// @Summary      List of sessions
+// @Description  List of active sessions of Admin or Staff User
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {array}  repository.Session
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/sessions [get]
+func (ctrl *Controller) Sessions(c echo.Context) error {
+	sessions, err := ctrl.sessionRepo.Sessions(c.Request().Context(), currentUserID(c), c.Get("token").(string))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession Revoke a session
+//
+// @Summary      Revoke session
+// @Description  Revoke a session of Admin or Staff User by id
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 id path int true "Session ID"
+// @Success      204  {object}  nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/sessions/:id [delete]
+func (ctrl *Controller) RevokeSession(c echo.Context) error {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.BadRequest(c, errors.New("invalid session id"))
+	}
+	err = ctrl.sessionRepo.Revoke(c.Request().Context(), currentUserID(c), uint(sessionID))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeOtherSessions Revoke other sessions
+//
+// @Summary      Revoke other sessions
+// @Description  Revoke all sessions of Admin or Staff User except the current one
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      204  {object}  nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/sessions [delete]
+func (ctrl *Controller) RevokeOtherSessions(c echo.Context) error {
+	err := ctrl.sessionRepo.RevokeOthers(c.Request().Context(), currentUserID(c), c.Get("token").(string))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ApiKeys List of api keys
+//
+// @Summary      List of api keys
+// @Description  List of api keys of Admin or Staff User. Keys are not returned, only their prefix
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Success      200  {array}  entities.ApiKey
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/api_keys [get]
+func (ctrl *Controller) ApiKeys(c echo.Context) error {
+	apiKeys, err := ctrl.apiKeyRepo.ApiKeys(c.Request().Context(), currentUserID(c))
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusOK, apiKeys)
+}
+
+// CreateApiKey Create api key
+//
+// @Summary      Create api key
+// @Description  Create api key for automation scoped to a subset of user permissions. The key is returned only once and must be sent in X-API-Key header or as Bearer token
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param        request    body  CreateApiKeyRequest   true "api key data"
+// @Success      201  {object}  repository.ApiKeyCreated
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/api_keys [post]
+func (ctrl *Controller) CreateApiKey(c echo.Context) error {
+	var data CreateApiKeyRequest
+	if err := ctrl.validator.Validate(c, &data); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	apiKey, err := ctrl.apiKeyRepo.Create(ctx, currentUserID(c), &repository.CreateApiKey{
+		Name:       data.Name,
+		Permission: data.Permission,
+		AllowedIPs: data.AllowedIPs,
+		ExpireAt:   data.ExpireAt,
+	})
+	if err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.JSON(http.StatusCreated, apiKey)
+}
+
+// RevokeApiKey Revoke api key
+//
+// @Summary      Revoke api key
+// @Description  Revoke api key of Admin or Staff User by id
+// @Tags         Site User
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer TOKEN"
+// @Param 		 id path int true "Api key ID"
+// @Success      204  {object}  nil
+// @Failure      400 {object} utils.ErrorResponse
+// @Failure      401 {object} middlewares.Unauthorized
+// @Router       /api/v1/user/api_keys/:id [delete]
+func (ctrl *Controller) RevokeApiKey(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return utils.BadRequest(c, errors.New("invalid api key id"))
+	}
+	ctx := context.WithValue(c.Request().Context(), "userID", c.Get("userID"))
+	if err = ctrl.apiKeyRepo.Revoke(ctx, currentUserID(c), uint(id)); err != nil {
+		return utils.BadRequest(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
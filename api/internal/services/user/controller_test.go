@@ -0,0 +1,104 @@
+package user
+
+import (
+	"api/internal/entities"
+	"api/internal/repository"
+	"api/pkg/captcha"
+	"api/pkg/utils"
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakePanelRepo struct {
+	config    models.PanelConfig
+	configErr error
+	settings  entities.PanelSetting
+}
+
+func (f *fakePanelRepo) CreateConfig(c context.Context, config models.PanelConfig) error {
+	return nil
+}
+
+func (f *fakePanelRepo) UpdateConfig(c context.Context, siteKey, secretKet *string) error {
+	return nil
+}
+
+func (f *fakePanelRepo) GetConfig(c context.Context) (*models.PanelConfig, error) {
+	if f.configErr != nil {
+		return nil, f.configErr
+	}
+	return &f.config, nil
+}
+
+func (f *fakePanelRepo) GetSettings(c context.Context) (*entities.PanelSetting, error) {
+	return &f.settings, nil
+}
+
+func (f *fakePanelRepo) UpdateSettings(c context.Context, settings *entities.PanelSetting) error {
+	return nil
+}
+
+func (f *fakePanelRepo) PasswordPolicy(c context.Context) (*utils.PasswordPolicy, error) {
+	return &utils.PasswordPolicy{MinLength: f.settings.PasswordMinLength}, nil
+}
+
+func newCaptchaContext() echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user/login", nil)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestVerifyCaptcha(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("response") == "valid" && r.FormValue("secret") == "secret" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": false}`))
+	}))
+	defer server.Close()
+
+	ctrl := &Controller{panelRepo: &fakePanelRepo{
+		config:   models.PanelConfig{GoogleCaptchaSecretKey: "secret"},
+		settings: entities.PanelSetting{CaptchaProvider: captcha.Turnstile, CaptchaVerifyURL: server.URL},
+	}}
+	assert.NoError(t, ctrl.verifyCaptcha(newCaptchaContext(), "valid"))
+	assert.Error(t, ctrl.verifyCaptcha(newCaptchaContext(), "invalid"))
+	assert.Error(t, ctrl.verifyCaptcha(newCaptchaContext(), ""))
+}
+
+func TestVerifyCaptchaWithoutSecret(t *testing.T) {
+	ctrl := &Controller{panelRepo: &fakePanelRepo{}}
+	assert.NoError(t, ctrl.verifyCaptcha(newCaptchaContext(), ""))
+}
+
+func TestVerifyCaptchaWithoutPanelConfig(t *testing.T) {
+	ctrl := &Controller{panelRepo: &fakePanelRepo{configErr: gorm.ErrRecordNotFound}}
+	assert.NoError(t, ctrl.verifyCaptcha(newCaptchaContext(), ""))
+
+	ctrl = &Controller{panelRepo: &fakePanelRepo{configErr: errors.New("connection refused")}}
+	assert.EqualError(t, ctrl.verifyCaptcha(newCaptchaContext(), ""), "connection refused")
+}
+
+func TestLoginErrorBlocked(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	assert.NoError(t, loginError(c, &repository.LoginBlockedError{RetryAfter: 90 * time.Second}))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "90", rec.Header().Get("Retry-After"))
+}
+
+func TestLoginErrorInvalid(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	assert.NoError(t, loginError(c, errors.New("invalid username and password")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+}
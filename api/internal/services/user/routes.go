@@ -9,7 +9,30 @@ func Routes(e *echo.Group) {
 	controller := New()
 	group := e.Group("/user")
 	group.POST("/admin", controller.CreateSuperUser)
-	group.POST("/login", controller.Login)
-	group.DELETE("/logout", controller.Logout, middlewares.IsAuthenticatedMiddleware())
-	group.POST("/change_password", controller.ChangePassword, middlewares.IsAuthenticatedMiddleware())
+	group.POST("/login", controller.Login, middlewares.RateLimitMiddleware(10, "m", 5))
+	group.POST("/login/two_factor", controller.LoginTwoFactor, middlewares.RateLimitMiddleware(10, "m", 5))
+	group.POST("/login/two_factor/setup", controller.LoginTwoFactorSetup, middlewares.RateLimitMiddleware(10, "m", 5))
+	group.GET("/oidc", controller.OIDCProviders)
+	group.GET("/oidc/:provider", controller.OIDCLogin, middlewares.RateLimitMiddleware(10, "m", 5))
+	group.POST("/oidc/:provider/callback", controller.OIDCCallback, middlewares.RateLimitMiddleware(10, "m", 5))
+	group.DELETE("/logout", controller.Logout, middlewares.IsTokenAuthenticatedMiddleware())
+	group.GET("/me", controller.Me, middlewares.IsTokenAuthenticatedMiddleware())
+	group.PATCH("/me", controller.UpdateMe, middlewares.IsTokenAuthenticatedMiddleware())
+	group.POST("/change_password", controller.ChangePassword, middlewares.IsTokenAuthenticatedMiddleware())
+
+	sessions := group.Group("/sessions", middlewares.IsTokenAuthenticatedMiddleware())
+	sessions.GET("", controller.Sessions)
+	sessions.DELETE("", controller.RevokeOtherSessions)
+	sessions.DELETE("/:id", controller.RevokeSession)
+
+	apiKeys := group.Group("/api_keys", middlewares.IsTokenAuthenticatedMiddleware())
+	apiKeys.GET("", controller.ApiKeys)
+	apiKeys.POST("", controller.CreateApiKey)
+	apiKeys.DELETE("/:id", controller.RevokeApiKey)
+
+	twoFactor := group.Group("/two_factor", middlewares.IsTokenAuthenticatedMiddleware())
+	twoFactor.POST("/setup", controller.TwoFactorSetup)
+	twoFactor.POST("/confirm", controller.TwoFactorConfirm)
+	twoFactor.POST("/recovery_codes", controller.TwoFactorRecoveryCodes)
+	twoFactor.DELETE("", controller.TwoFactorDisable)
 }
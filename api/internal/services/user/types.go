@@ -1,5 +1,10 @@
 package user
 
+import (
+	"github.com/mmtaee/go-oc-utils/models"
+	"time"
+)
+
 type CreateAdminUserRequest struct {
 	Username string `json:"username" validate:"required,min=2,max=16" example:"john_doe" `
 	Password string `json:"password" validate:"required,min=2,max=16" example:"doe123456"`
@@ -13,13 +18,70 @@ type LoginRequest struct {
 	Username   string `json:"username" validate:"required,min=2,max=16"`
 	Password   string `json:"password" validate:"required,min=2,max=16"`
 	RememberMe bool   `json:"remember_me"`
+	Captcha    string `json:"captcha" validate:"omitempty"`
 }
 
 type LoginResponse struct {
-	Token string `json:"token" validate:"required"`
+	Token                  string `json:"token,omitempty"`
+	Challenge              string `json:"challenge,omitempty"`
+	TwoFactorRequired      bool   `json:"two_factor_required"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required"`
+}
+
+type TwoFactorLoginRequest struct {
+	Challenge    string `json:"challenge" validate:"required"`
+	Code         string `json:"code" validate:"omitempty,len=6,numeric" example:"123456"`
+	RecoveryCode string `json:"recovery_code" validate:"omitempty,max=16" example:"abcde-fghij"`
+}
+
+type TwoFactorLoginResponse struct {
+	Token         string   `json:"token"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type TwoFactorLoginSetupRequest struct {
+	Challenge string `json:"challenge" validate:"required"`
+}
+
+type OIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+type OIDCLoginResponse struct {
+	AuthURL string `json:"auth_url"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required,max=2048"`
+	State string `json:"state" validate:"required,max=64"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric" example:"123456"`
+}
+
+type TwoFactorDisableRequest struct {
+	Code string `json:"code" validate:"omitempty,len=6,numeric" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" validate:"required,min=2,max=16"`
 	NewPassword string `json:"new_password" validate:"required,min=2,max=16"`
 }
+
+type CreateApiKeyRequest struct {
+	Name       string                `json:"name" validate:"required,max=64"`
+	Permission models.UserPermission `json:"permission"`
+	AllowedIPs []string              `json:"allowed_ips" validate:"omitempty,max=32,dive,ip|cidr" example:"10.0.0.0/24"`
+	ExpireAt   *time.Time            `json:"expire_at" validate:"omitempty"`
+}
+
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name" validate:"omitempty,max=64" example:"John Doe"`
+	Email       *string `json:"email" validate:"omitempty,max=255,eq=|email" example:"john@example.org"`
+	Language    *string `json:"language" validate:"omitempty,max=16,eq=|bcp47_language_tag" example:"en"`
+}
@@ -0,0 +1,94 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported captcha providers
+const (
+	ReCaptcha = "recaptcha"
+	HCaptcha  = "hcaptcha"
+	Turnstile = "turnstile"
+)
+
+// verifyURLs default siteverify endpoints of providers
+var verifyURLs = map[string]string{
+	ReCaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	HCaptcha:  "https://api.hcaptcha.com/siteverify",
+	Turnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+type Verifier interface {
+	Verify(c context.Context, token, remoteIP string) error
+}
+
+// SiteVerifier verify tokens with the siteverify api shared by reCAPTCHA, hCaptcha and Turnstile
+type SiteVerifier struct {
+	Secret string
+	URL    string
+	Client *http.Client
+}
+
+type verifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// New create Verifier of provider. An empty verifyURL uses the provider default endpoint.
+func New(provider, secret, verifyURL string) (Verifier, error) {
+	if provider == "" {
+		provider = ReCaptcha
+	}
+	defaultURL, ok := verifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("invalid captcha provider: %s", provider)
+	}
+	if verifyURL == "" {
+		verifyURL = defaultURL
+	}
+	return &SiteVerifier{
+		Secret: secret,
+		URL:    verifyURL,
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+func (v *SiteVerifier) Verify(c context.Context, token, remoteIP string) error {
+	if token == "" {
+		return errors.New("captcha is required")
+	}
+	form := url.Values{}
+	form.Set("secret", v.Secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(c, http.MethodPost, v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha verification failed: status %d", resp.StatusCode)
+	}
+	var result verifyResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification failed: %w", err)
+	}
+	if !result.Success {
+		return errors.New("invalid captcha")
+	}
+	return nil
+}
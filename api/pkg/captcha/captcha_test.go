@@ -0,0 +1,55 @@
+package captcha
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newStandIn(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "secret", r.PostForm.Get("secret"))
+		assert.Equal(t, "127.0.0.1", r.PostForm.Get("remoteip"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("response") == "valid" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVerify(t *testing.T) {
+	server := newStandIn(t)
+	for _, provider := range []string{ReCaptcha, HCaptcha, Turnstile} {
+		verifier, err := New(provider, "secret", server.URL)
+		assert.NoError(t, err)
+		assert.NoError(t, verifier.Verify(context.Background(), "valid", "127.0.0.1"))
+		assert.Error(t, verifier.Verify(context.Background(), "invalid", "127.0.0.1"))
+		assert.Error(t, verifier.Verify(context.Background(), "", "127.0.0.1"))
+	}
+}
+
+func TestVerifyServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	verifier, err := New(ReCaptcha, "secret", server.URL)
+	assert.NoError(t, err)
+	assert.Error(t, verifier.Verify(context.Background(), "valid", ""))
+}
+
+func TestNew(t *testing.T) {
+	verifier, err := New("", "secret", "")
+	assert.NoError(t, err)
+	assert.Equal(t, verifyURLs[ReCaptcha], verifier.(*SiteVerifier).URL)
+
+	_, err = New("unknown", "secret", "")
+	assert.Error(t, err)
+}
@@ -4,14 +4,18 @@ import (
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/mmtaee/go-oc-utils/logger"
+	"github.com/mmtaee/go-oc-utils/models"
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Config struct {
-	APP APP
-	DB  DB
+	APP  APP
+	DB   DB
+	LDAP LDAP
+	OIDC []OIDCProvider
 }
 
 type APP struct {
@@ -20,8 +24,14 @@ type APP struct {
 	Host           string
 	Port           string
 	AllowOrigins   []string
+	TrustedProxies []string
 	InitSecretFile string
+	OcpasswdFile   string
 	Isolate        bool
+	// ReconcileInterval period of the drift check of ocpasswd, zero disables it
+	ReconcileInterval time.Duration
+	// ReconcileRepair repair ocpasswd on each periodic drift check
+	ReconcileRepair bool
 }
 
 type DB struct {
@@ -32,6 +42,45 @@ type DB struct {
 	Password string
 }
 
+// GroupPermissions groups of a directory or an identity provider that grant admin status and staff permissions
+type GroupPermissions struct {
+	AdminGroups     []string
+	OcUserGroups    []string
+	OcGroupGroups   []string
+	OcctlGroups     []string
+	StatisticGroups []string
+	SystemGroups    []string
+}
+
+// LDAP directory used to authenticate staff. It is enabled when URL is set.
+// Group lists are full group DNs separated by ';'.
+type LDAP struct {
+	URL                string
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	GroupAttribute     string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	CACertFile         string
+	GroupPermissions
+}
+
+// OIDCProvider OpenID Connect provider used for single sign-on of staff.
+// Providers are listed by name in OIDC_PROVIDERS and configured with OIDC_<NAME>_* variables.
+type OIDCProvider struct {
+	Name          string
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string
+	GroupsClaim   string
+	GroupPermissions
+}
+
 var (
 	config  Config
 	AppInit bool
@@ -70,6 +119,21 @@ func Set(debug bool) {
 		InitSecretFile = "./init_secret"
 	}
 
+	ocpasswdFile := os.Getenv("OCPASSWD_FILE")
+	if ocpasswdFile == "" {
+		ocpasswdFile = "/etc/ocserv/ocpasswd"
+	}
+
+	reconcileInterval := time.Hour
+	if interval := os.Getenv("OCPASSWD_RECONCILE_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < 0 {
+			logger.Logf(logger.WARNING, "invalid OCPASSWD_RECONCILE_INTERVAL %q, set default interval to %s", interval, reconcileInterval)
+		} else {
+			reconcileInterval = d
+		}
+	}
+
 	host := os.Getenv("HOST")
 	if host == "" {
 		host = "0.0.0.0"
@@ -81,11 +145,14 @@ func Set(debug bool) {
 	}
 
 	config.APP = APP{
-		Debug:          debug,
-		Host:           host,
-		Port:           port,
-		SecretKey:      secretKey,
-		InitSecretFile: InitSecretFile,
+		Debug:             debug,
+		Host:              host,
+		Port:              port,
+		SecretKey:         secretKey,
+		InitSecretFile:    InitSecretFile,
+		OcpasswdFile:      ocpasswdFile,
+		ReconcileInterval: reconcileInterval,
+		ReconcileRepair:   os.Getenv("OCPASSWD_RECONCILE_REPAIR") == "true",
 	}
 
 	isolate := os.Getenv("ISOLATE")
@@ -100,6 +167,10 @@ func Set(debug bool) {
 		config.APP.AllowOrigins = strings.Split(allowOrigins, ",")
 	}
 
+	if trustedProxies := os.Getenv("TRUSTED_PROXIES"); trustedProxies != "" {
+		config.APP.TrustedProxies = strings.Split(trustedProxies, ",")
+	}
+
 	config.DB = DB{
 		Host:     os.Getenv("POSTGRES_HOST"),
 		Port:     os.Getenv("POSTGRES_PORT"),
@@ -108,9 +179,92 @@ func Set(debug bool) {
 		Password: os.Getenv("POSTGRES_PASSWORD"),
 	}
 
+	config.LDAP = LDAP{
+		URL:                os.Getenv("LDAP_URL"),
+		BindDN:             os.Getenv("LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:             os.Getenv("LDAP_BASE_DN"),
+		UserFilter:         os.Getenv("LDAP_USER_FILTER"),
+		GroupAttribute:     os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+		InsecureSkipVerify: os.Getenv("LDAP_TLS_SKIP_VERIFY") == "true",
+		CACertFile:         os.Getenv("LDAP_CA_CERT_FILE"),
+		GroupPermissions:   groupPermissions("LDAP_"),
+	}
+	if config.LDAP.UserFilter == "" {
+		config.LDAP.UserFilter = "(&(objectClass=person)(uid=%s))"
+	}
+	if config.LDAP.GroupAttribute == "" {
+		config.LDAP.GroupAttribute = "memberOf"
+	}
+
+	config.OIDC = oidcProviders()
+
 	logger.Log(logger.INFO, "Configuration applied successfully")
 }
 
+// groupPermissions read group lists of the environment variables starting with prefix
+func groupPermissions(prefix string) GroupPermissions {
+	return GroupPermissions{
+		AdminGroups:     splitGroups(os.Getenv(prefix + "ADMIN_GROUPS")),
+		OcUserGroups:    splitGroups(os.Getenv(prefix + "OC_USER_GROUPS")),
+		OcGroupGroups:   splitGroups(os.Getenv(prefix + "OC_GROUP_GROUPS")),
+		OcctlGroups:     splitGroups(os.Getenv(prefix + "OCCTL_GROUPS")),
+		StatisticGroups: splitGroups(os.Getenv(prefix + "STATISTIC_GROUPS")),
+		SystemGroups:    splitGroups(os.Getenv(prefix + "SYSTEM_GROUPS")),
+	}
+}
+
+// oidcProviders read providers named in OIDC_PROVIDERS, separated by ','. Providers without
+// issuer or client id are skipped.
+func oidcProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{
+			Name:             name,
+			Issuer:           os.Getenv(prefix + "ISSUER"),
+			ClientID:         os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret:     os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:      os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:           strings.Fields(os.Getenv(prefix + "SCOPES")),
+			UsernameClaim:    os.Getenv(prefix + "USERNAME_CLAIM"),
+			GroupsClaim:      os.Getenv(prefix + "GROUPS_CLAIM"),
+			GroupPermissions: groupPermissions(prefix),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			logger.Logf(logger.WARNING, "OIDC provider %s is skipped, issuer and client id are required", name)
+			continue
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"profile", "email"}
+		}
+		if provider.UsernameClaim == "" {
+			provider.UsernameClaim = "preferred_username"
+		}
+		if provider.GroupsClaim == "" {
+			provider.GroupsClaim = "groups"
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// splitGroups split groups separated by ';' since DNs contain commas
+func splitGroups(groups string) []string {
+	var result []string
+	for _, group := range strings.Split(groups, ";") {
+		if group = strings.TrimSpace(group); group != "" {
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
 func GetDB() *DB {
 	return &config.DB
 }
@@ -118,3 +272,33 @@ func GetDB() *DB {
 func GetApp() *APP {
 	return &config.APP
 }
+
+func GetLDAP() *LDAP {
+	return &config.LDAP
+}
+
+func GetOIDC() []OIDCProvider {
+	return config.OIDC
+}
+
+func memberOf(groups, mapped []string) bool {
+	for _, group := range groups {
+		for _, m := range mapped {
+			if strings.EqualFold(group, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permission map groups of a user to admin status and staff permission flags. Group names are case-insensitive.
+func (g *GroupPermissions) Permission(groups []string) (bool, models.UserPermission) {
+	return memberOf(groups, g.AdminGroups), models.UserPermission{
+		OcUser:    memberOf(groups, g.OcUserGroups),
+		OcGroup:   memberOf(groups, g.OcGroupGroups),
+		Occtl:     memberOf(groups, g.OcctlGroups),
+		Statistic: memberOf(groups, g.StatisticGroups),
+		System:    memberOf(groups, g.SystemGroups),
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGroupPermissions(t *testing.T) {
+	groups := &GroupPermissions{
+		AdminGroups:  []string{"cn=admins,dc=example,dc=org"},
+		OcUserGroups: []string{"cn=vpn-operators,dc=example,dc=org", "cn=helpdesk,dc=example,dc=org"},
+		OcctlGroups:  []string{"cn=vpn-operators,dc=example,dc=org"},
+	}
+	isAdmin, permission := groups.Permission([]string{"CN=VPN-Operators,DC=example,DC=org"})
+	assert.False(t, isAdmin)
+	assert.True(t, permission.OcUser)
+	assert.True(t, permission.Occtl)
+	assert.False(t, permission.System)
+
+	isAdmin, _ = groups.Permission([]string{"cn=admins,dc=example,dc=org"})
+	assert.True(t, isAdmin)
+}
+
+func TestOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "Keycloak, google,broken")
+	t.Setenv("OIDC_KEYCLOAK_ISSUER", "https://sso.example.org/realms/vpn")
+	t.Setenv("OIDC_KEYCLOAK_CLIENT_ID", "panel")
+	t.Setenv("OIDC_KEYCLOAK_SCOPES", "profile roles")
+	t.Setenv("OIDC_KEYCLOAK_ADMIN_GROUPS", "vpn-admins;ops")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "panel.apps.googleusercontent.com")
+	t.Setenv("OIDC_GOOGLE_USERNAME_CLAIM", "email")
+	t.Setenv("OIDC_BROKEN_ISSUER", "https://broken.example.org")
+
+	providers := oidcProviders()
+	assert.Len(t, providers, 2)
+	assert.Equal(t, "keycloak", providers[0].Name)
+	assert.Equal(t, []string{"profile", "roles"}, providers[0].Scopes)
+	assert.Equal(t, "preferred_username", providers[0].UsernameClaim)
+	assert.Equal(t, []string{"vpn-admins", "ops"}, providers[0].AdminGroups)
+	assert.Equal(t, "google", providers[1].Name)
+	assert.Equal(t, []string{"profile", "email"}, providers[1].Scopes)
+	assert.Equal(t, "email", providers[1].UsernameClaim)
+	assert.Equal(t, "groups", providers[1].GroupsClaim)
+}
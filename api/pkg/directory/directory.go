@@ -0,0 +1,141 @@
+package directory
+
+import (
+	"api/pkg/config"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"os"
+	"time"
+)
+
+// ErrInvalidCredentials returned when the user is not found in the directory or the password is wrong
+var ErrInvalidCredentials = errors.New("invalid directory credentials")
+
+const timeout = 10 * time.Second
+
+// Entry staff user found in the directory
+type Entry struct {
+	DN       string
+	Username string
+	Groups   []string
+}
+
+// Authenticator authenticate staff against a directory
+type Authenticator interface {
+	Authenticate(username, password string) (*Entry, error)
+}
+
+// Conn is the part of *ldap.Conn used to authenticate. It allows an in-process directory in tests.
+type Conn interface {
+	StartTLS(config *tls.Config) error
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+type Client struct {
+	cfg  *config.LDAP
+	dial func() (Conn, error)
+}
+
+// New create a directory client of LDAP config
+func New(cfg *config.LDAP) *Client {
+	client := &Client{cfg: cfg}
+	client.dial = client.dialURL
+	return client
+}
+
+// NewWithDialer create a directory client that uses dial to open connections
+func NewWithDialer(cfg *config.LDAP, dial func() (Conn, error)) *Client {
+	return &Client{cfg: cfg, dial: dial}
+}
+
+func (l *Client) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: l.cfg.InsecureSkipVerify}
+	if l.cfg.CACertFile != "" {
+		pem, err := os.ReadFile(l.cfg.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", l.cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func (l *Client) dialURL() (Conn, error) {
+	tlsConfig, err := l.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ldap.DialURL(l.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+	return conn, nil
+}
+
+// Authenticate find username with the search filter and bind with its DN and password
+func (l *Client) Authenticate(username, password string) (*Entry, error) {
+	// An empty password is an unauthenticated bind that most servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if l.cfg.StartTLS {
+		tlsConfig, err := l.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	if l.cfg.BindDN != "" {
+		if err = conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("directory service bind failed: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(timeout.Seconds()),
+		false,
+		fmt.Sprintf(l.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{l.cfg.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	return &Entry{
+		DN:       entry.DN,
+		Username: username,
+		Groups:   entry.GetAttributeValues(l.cfg.GroupAttribute),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package directory
+
+import (
+	"api/pkg/config"
+	"crypto/tls"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fakeDirectory in-process directory stand-in that matches the (uid=%s) filter
+type fakeDirectory struct {
+	users     map[string]string
+	passwords map[string]string
+	groups    map[string][]string
+	filters   []string
+	startTLS  bool
+}
+
+type fakeConn struct {
+	dir *fakeDirectory
+}
+
+func (f *fakeConn) StartTLS(*tls.Config) error {
+	f.dir.startTLS = true
+	return nil
+}
+
+func (f *fakeConn) Bind(username, password string) error {
+	if p, ok := f.dir.passwords[username]; ok && p == password {
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, nil)
+}
+
+func (f *fakeConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	f.dir.filters = append(f.dir.filters, request.Filter)
+	result := &ldap.SearchResult{}
+	for username, dn := range f.dir.users {
+		if request.Filter == "(uid="+username+")" {
+			result.Entries = append(result.Entries, ldap.NewEntry(dn, map[string][]string{"memberOf": f.dir.groups[dn]}))
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeConn) Close() error {
+	return nil
+}
+
+func newTestClient(cfg *config.LDAP) (*Client, *fakeDirectory) {
+	dir := &fakeDirectory{
+		users: map[string]string{
+			"alice": "uid=alice,ou=people,dc=example,dc=org",
+		},
+		passwords: map[string]string{
+			"cn=reader,dc=example,dc=org":           "reader",
+			"uid=alice,ou=people,dc=example,dc=org": "alice-pass",
+		},
+		groups: map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=org": {"cn=vpn-operators,ou=groups,dc=example,dc=org"},
+		},
+	}
+	return NewWithDialer(cfg, func() (Conn, error) { return &fakeConn{dir: dir}, nil }), dir
+}
+
+func testConfig() *config.LDAP {
+	return &config.LDAP{
+		BindDN:         "cn=reader,dc=example,dc=org",
+		BindPassword:   "reader",
+		BaseDN:         "dc=example,dc=org",
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		StartTLS:       true,
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	client, dir := newTestClient(testConfig())
+	entry, err := client.Authenticate("alice", "alice-pass")
+	assert.NoError(t, err)
+	assert.Equal(t, "uid=alice,ou=people,dc=example,dc=org", entry.DN)
+	assert.Equal(t, []string{"cn=vpn-operators,ou=groups,dc=example,dc=org"}, entry.Groups)
+	assert.True(t, dir.startTLS)
+
+	_, err = client.Authenticate("alice", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = client.Authenticate("bob", "alice-pass")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = client.Authenticate("alice", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestAuthenticateEscapesFilter(t *testing.T) {
+	client, dir := newTestClient(testConfig())
+	_, err := client.Authenticate("*)(uid=*", "x")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, `(uid=\2a\29\28uid=\2a)`, dir.filters[0])
+}
+
+func TestAuthenticateServiceBindFailure(t *testing.T) {
+	cfg := testConfig()
+	cfg.BindPassword = "wrong"
+	client, _ := newTestClient(cfg)
+	_, err := client.Authenticate("alice", "alice-pass")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+}
@@ -20,6 +20,12 @@ type Event struct {
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
 
+// SystemUserUID user uid of events raised by the panel itself, e.g. login lockouts
+const SystemUserUID = "system"
+
+// CLIUserUID user uid of events raised by administrative subcommands of the api binary
+const CLIUserUID = "cli"
+
 // SchemaEvent struct request schema
 type SchemaEvent struct {
 	ID        uint        `json:"id"`
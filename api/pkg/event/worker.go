@@ -80,3 +80,18 @@ func (w *WorkerEvent) AddEvent(event *SchemaEvent) {
 		logger.InfoF("Event worker %s shutting down...", w.ctx.Err().Error())
 	}
 }
+
+// Drain apply queued events in the calling goroutine. Short-lived commands that do not start
+// workers call it before exit so their events are recorded.
+func (w *WorkerEvent) Drain() {
+	for {
+		select {
+		case e := <-w.eventChan:
+			if err := w.handler.Apply(w.ctx, e); err != nil {
+				logger.Logf(logger.ERROR, "failed to process event: %v", err)
+			}
+		default:
+			return
+		}
+	}
+}
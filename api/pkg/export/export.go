@@ -0,0 +1,148 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Formats of exports
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+	XLSX   = "xlsx"
+)
+
+// Formats all formats
+var Formats = []string{CSV, NDJSON, XLSX}
+
+// Writer write the rows of an export as they are read, so exports are never held in memory
+type Writer interface {
+	// Write a row with a value for every column of the header
+	Write(row ...interface{}) error
+	// Close write the end of the export, it does not close the underlying writer
+	Close() error
+}
+
+// New create a writer of format with header as first row, or as keys of ndjson objects
+func New(w io.Writer, format string, header []string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSV(w, header)
+	case NDJSON:
+		return &ndjsonWriter{w: w, header: header}, nil
+	case XLSX:
+		return newXLSX(w, header)
+	}
+	return nil, fmt.Errorf("unknown export format %s", format)
+}
+
+// ContentType media type of format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Filename name of an export file of format
+func Filename(name, format string) string {
+	return fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+}
+
+// text value as text, times in RFC 3339 and nil as empty
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSV(w io.Writer, header []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(row ...interface{}) error {
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = text(value)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	w      io.Writer
+	header []string
+	buf    bytes.Buffer
+}
+
+// Write an object with the keys in the order of the header
+func (nw *ndjsonWriter) Write(row ...interface{}) error {
+	nw.buf.Reset()
+	nw.buf.WriteByte('{')
+	for i, value := range row {
+		if i > 0 {
+			nw.buf.WriteByte(',')
+		}
+		key, err := json.Marshal(nw.header[i])
+		if err != nil {
+			return err
+		}
+		switch v := value.(type) {
+		case time.Time:
+			value = text(v)
+		case *time.Time:
+			if v != nil {
+				value = text(v)
+			}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		nw.buf.Write(key)
+		nw.buf.WriteByte(':')
+		nw.buf.Write(data)
+	}
+	nw.buf.WriteString("}\n")
+	_, err := nw.w.Write(nw.buf.Bytes())
+	return err
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, format string) []byte {
+	var buf bytes.Buffer
+	w, err := New(&buf, format, []string{"username", "traffic_size", "is_locked", "expire_at"})
+	assert.NoError(t, err)
+	expireAt := time.Date(2025, 3, 10, 8, 30, 0, 0, time.UTC)
+	assert.NoError(t, w.Write("user1", 20, true, &expireAt))
+	assert.NoError(t, w.Write("a<b, \"c\"", 0, false, (*time.Time)(nil)))
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	assert.Equal(t, "username,traffic_size,is_locked,expire_at\n"+
+		"user1,20,true,2025-03-10T08:30:00Z\n"+
+		"\"a<b, \"\"c\"\"\",0,false,\n", string(write(t, CSV)))
+}
+
+func TestNDJSON(t *testing.T) {
+	assert.Equal(t, `{"username":"user1","traffic_size":20,"is_locked":true,"expire_at":"2025-03-10T08:30:00Z"}`+"\n"+
+		`{"username":"a\u003cb, \"c\"","traffic_size":0,"is_locked":false,"expire_at":null}`+"\n", string(write(t, NDJSON)))
+}
+
+func TestXLSX(t *testing.T) {
+	data := write(t, XLSX)
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	var names []string
+	var sheet []byte
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			assert.NoError(t, err)
+			sheet, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml",
+	}, names)
+	assert.Contains(t, string(sheet), `<row><c t="inlineStr"><is><t xml:space="preserve">user1</t></is></c><c><v>20</v></c>`)
+	assert.Contains(t, string(sheet), `a&lt;b, &#34;c&#34;`)
+	assert.Contains(t, string(sheet), "</sheetData></worksheet>")
+}
+
+func TestNewUnknownFormat(t *testing.T) {
+	_, err := New(io.Discard, "pdf", nil)
+	assert.EqualError(t, err, "unknown export format pdf")
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+// xlsxParts fixed parts of a workbook with a single sheet
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// xlsxWriter write a workbook part by part, the rows of the sheet are compressed as they are
+// written so the workbook is streamed
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+}
+
+func newXLSX(w io.Writer, header []string) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		fw, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(fw, part.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw := &xlsxWriter{zw: zw, sheet: sheet}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]interface{}, len(header))
+	for i, name := range header {
+		row[i] = name
+	}
+	if err = xw.Write(row...); err != nil {
+		return nil, err
+	}
+	return xw, nil
+}
+
+// Write a row, numbers are numeric cells and other values inline strings
+func (xw *xlsxWriter) Write(row ...interface{}) error {
+	if _, err := io.WriteString(xw.sheet, "<row>"); err != nil {
+		return err
+	}
+	for _, value := range row {
+		var number string
+		switch v := value.(type) {
+		case int:
+			number = strconv.Itoa(v)
+		case int64:
+			number = strconv.FormatInt(v, 10)
+		case uint:
+			number = strconv.FormatUint(uint64(v), 10)
+		case float64:
+			number = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		if number != "" {
+			if _, err := io.WriteString(xw.sheet, "<c><v>"+number+"</v></c>"); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.WriteString(xw.sheet, `<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(xw.sheet, []byte(text(value))); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(xw.sheet, "</t></is></c>"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(xw.sheet, "</row>")
+	return err
+}
+
+func (xw *xlsxWriter) Close() error {
+	if _, err := io.WriteString(xw.sheet, "</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
@@ -0,0 +1,79 @@
+// Package ocpasswd read ocpasswd files. The ocuser handler of go-oc-utils only changes entries
+// through the ocpasswd command and has no way to list them, so entries are parsed here in the
+// format that command writes.
+package ocpasswd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// NoGroup group of entries that are not in a group
+const NoGroup = "*"
+
+// Entry user of an ocpasswd file. Passwords are hashed, so they are not kept.
+type Entry struct {
+	Line     int
+	Username string
+	Group    string
+	Locked   bool
+}
+
+// LineError invalid line of an ocpasswd file
+type LineError struct {
+	Line   int
+	Reason string
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// Parse read the entries of an ocpasswd file, lines are username:group:hash and the hash of
+// locked users starts with '!'. Empty lines and comments are skipped, invalid lines are
+// returned with the entries.
+func Parse(r io.Reader) ([]Entry, []LineError, error) {
+	var (
+		entries []Entry
+		invalid []LineError
+	)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, ":", 3)
+		if len(fields) != 3 {
+			invalid = append(invalid, LineError{Line: line, Reason: "expected username:group:password"})
+			continue
+		}
+		if fields[0] == "" {
+			invalid = append(invalid, LineError{Line: line, Reason: "username is empty"})
+			continue
+		}
+		entries = append(entries, Entry{
+			Line:     line,
+			Username: fields[0],
+			Group:    fields[1],
+			Locked:   strings.HasPrefix(fields[2], "!"),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return entries, invalid, nil
+}
+
+// Read parse the ocpasswd file of path
+func Read(path string) ([]Entry, []LineError, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
@@ -0,0 +1,27 @@
+package ocpasswd
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	file := "# users\n" +
+		"user1:defaults:$5$salt$hash\n" +
+		"\n" +
+		"user2:*:!$5$salt$hash\n" +
+		"broken\n" +
+		":defaults:$5$salt$hash\n"
+	entries, invalid, err := Parse(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Line: 2, Username: "user1", Group: "defaults"},
+		{Line: 4, Username: "user2", Group: NoGroup, Locked: true},
+	}, entries)
+	assert.Equal(t, []LineError{
+		{Line: 5, Reason: "expected username:group:password"},
+		{Line: 6, Reason: "username is empty"},
+	}, invalid)
+	assert.EqualError(t, &invalid[0], "line 5: expected username:group:password")
+}
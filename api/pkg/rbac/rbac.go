@@ -0,0 +1,137 @@
+package rbac
+
+import (
+	"github.com/mmtaee/go-oc-utils/models"
+	"slices"
+	"strings"
+)
+
+// Action fine-grained operation of a staff user named <area>.<operation>. The area is the
+// permission flag of models.UserPermission that grants the action.
+type Action string
+
+const (
+	OcUserRead           Action = "oc_user.read"
+	OcUserCreate         Action = "oc_user.create"
+	OcUserUpdate         Action = "oc_user.update"
+	OcUserPassword       Action = "oc_user.password"
+	OcUserLock           Action = "oc_user.lock"
+	OcUserDisconnect     Action = "oc_user.disconnect"
+	OcUserDelete         Action = "oc_user.delete"
+	OcUserExportPassword Action = "oc_user.export_password"
+	OcGroupRead          Action = "oc_group.read"
+	OcGroupWrite         Action = "oc_group.write"
+	OcctlRead            Action = "occtl.read"
+	OcctlReload          Action = "occtl.reload"
+	OcctlDisconnect      Action = "occtl.disconnect"
+	OcctlUnban           Action = "occtl.unban"
+	StatisticRead        Action = "statistic.read"
+	SystemRead           Action = "system.read"
+)
+
+// Areas of actions, they are the names of the built-in roles
+const (
+	OcUserArea    = "oc_user"
+	OcGroupArea   = "oc_group"
+	OcctlArea     = "occtl"
+	StatisticArea = "statistic"
+	SystemArea    = "system"
+)
+
+// Actions all actions in display order
+var Actions = []Action{
+	OcUserRead, OcUserCreate, OcUserUpdate, OcUserPassword, OcUserLock, OcUserDisconnect, OcUserDelete,
+	OcUserExportPassword,
+	OcGroupRead, OcGroupWrite,
+	OcctlRead, OcctlReload, OcctlDisconnect, OcctlUnban,
+	StatisticRead,
+	SystemRead,
+}
+
+// explicitActions actions that are only granted by custom roles
+var explicitActions = []Action{OcUserExportPassword}
+
+// Areas all areas in the order of models.UserPermission flags
+var Areas = []string{OcUserArea, OcGroupArea, OcctlArea, StatisticArea, SystemArea}
+
+// Area return the area of action
+func (a Action) Area() string {
+	area, _, _ := strings.Cut(string(a), ".")
+	return area
+}
+
+// Valid report whether action is known
+func Valid(action string) bool {
+	for _, a := range Actions {
+		if string(a) == action {
+			return true
+		}
+	}
+	return false
+}
+
+// AreaActions all actions of area except explicit ones. A built-in role holds the actions of its area.
+func AreaActions(area string) []string {
+	var actions []string
+	for _, a := range Actions {
+		if a.Area() == area && !slices.Contains(explicitActions, a) {
+			actions = append(actions, string(a))
+		}
+	}
+	return actions
+}
+
+// AreaGranted report whether the flag of area is set in permission
+func AreaGranted(permission models.UserPermission, area string) bool {
+	switch area {
+	case OcUserArea:
+		return permission.OcUser
+	case OcGroupArea:
+		return permission.OcGroup
+	case OcctlArea:
+		return permission.Occtl
+	case StatisticArea:
+		return permission.Statistic
+	case SystemArea:
+		return permission.System
+	}
+	return false
+}
+
+// Permission flags of areas
+func Permission(areas []string) models.UserPermission {
+	var permission models.UserPermission
+	for _, area := range areas {
+		switch area {
+		case OcUserArea:
+			permission.OcUser = true
+		case OcGroupArea:
+			permission.OcGroup = true
+		case OcctlArea:
+			permission.Occtl = true
+		case StatisticArea:
+			permission.Statistic = true
+		case SystemArea:
+			permission.System = true
+		}
+	}
+	return permission
+}
+
+// Set actions of a staff user
+type Set map[Action]struct{}
+
+// NewSet create a set of actions
+func NewSet(actions ...string) Set {
+	set := make(Set, len(actions))
+	for _, action := range actions {
+		set[Action(action)] = struct{}{}
+	}
+	return set
+}
+
+// Has report whether action is in the set
+func (s Set) Has(action Action) bool {
+	_, ok := s[action]
+	return ok
+}
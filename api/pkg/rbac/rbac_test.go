@@ -0,0 +1,36 @@
+package rbac
+
+import (
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAreaActions(t *testing.T) {
+	assert.Equal(t, []string{"oc_group.read", "oc_group.write"}, AreaActions(OcGroupArea))
+	assert.NotContains(t, AreaActions(OcUserArea), string(OcUserExportPassword))
+	assert.True(t, Valid(string(OcUserExportPassword)))
+	for _, action := range Actions {
+		assert.Contains(t, Areas, action.Area(), action)
+	}
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("occtl.reload"))
+	assert.False(t, Valid("occtl"))
+	assert.False(t, Valid("occtl.delete"))
+}
+
+func TestPermission(t *testing.T) {
+	permission := Permission([]string{OcUserArea, SystemArea})
+	assert.Equal(t, models.UserPermission{OcUser: true, System: true}, permission)
+	for _, area := range Areas {
+		assert.Equal(t, area == OcUserArea || area == SystemArea, AreaGranted(permission, area), area)
+	}
+}
+
+func TestSet(t *testing.T) {
+	set := NewSet("oc_user.read", "oc_user.disconnect")
+	assert.True(t, set.Has(OcUserRead))
+	assert.False(t, set.Has(OcUserDelete))
+}
@@ -0,0 +1,39 @@
+package routing
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/mmtaee/go-oc-utils/logger"
+	"net"
+	"strings"
+)
+
+// ipExtractor client ip of requests for RealIP. X-Forwarded-For is only trusted from the given
+// proxies, without them the ip of the connection is used, so clients can not choose the ip that
+// rate limits, login lockouts and api key allowlists see.
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	var options []echo.TrustOption
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			logger.Logf(logger.WARNING, "trusted proxy %s is skipped: %v", proxy, err)
+			continue
+		}
+		options = append(options, echo.TrustIPRange(network))
+	}
+	if len(options) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options = append(options, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+	return echo.ExtractIPFromXFFHeader(options...)
+}
@@ -0,0 +1,32 @@
+package routing
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func forwardedRequest(remoteAddr string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
+	req.Header.Set(echo.HeaderXRealIP, "198.51.100.8")
+	return req
+}
+
+func TestIPExtractorWithoutTrustedProxies(t *testing.T) {
+	extract := ipExtractor(nil)
+	assert.Equal(t, "203.0.113.5", extract(forwardedRequest("203.0.113.5:4000")))
+	assert.Equal(t, "127.0.0.1", extract(forwardedRequest("127.0.0.1:4000")))
+}
+
+func TestIPExtractorTrustedProxies(t *testing.T) {
+	extract := ipExtractor([]string{"10.0.0.0/8", " 203.0.113.5", "invalid"})
+	assert.Equal(t, "198.51.100.7", extract(forwardedRequest("10.1.2.3:4000")))
+	assert.Equal(t, "198.51.100.7", extract(forwardedRequest("203.0.113.5:4000")))
+	// private networks and loopback are only trusted when they are listed
+	assert.Equal(t, "192.168.1.1", extract(forwardedRequest("192.168.1.1:4000")))
+	assert.Equal(t, "127.0.0.1", extract(forwardedRequest("127.0.0.1:4000")))
+}
@@ -0,0 +1,27 @@
+package routing
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddlewareUntimedPaths(t *testing.T) {
+	e := echo.New()
+	slow := func(c echo.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return c.NoContent(http.StatusOK)
+	}
+	timeout := TimeoutMiddleware(10 * time.Millisecond)
+	for _, path := range []string{"/api/v1/ocserv/users/export", "/api/v1/ocserv/users/:uid/statistics/export"} {
+		e.GET(path, slow, timeout)
+	}
+	for _, path := range []string{"/api/v1/ocserv/users/export", "/api/v1/ocserv/users/uid/statistics/export"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+}
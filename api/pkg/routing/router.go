@@ -36,6 +36,7 @@ func Serve() {
 	server := fmt.Sprintf("%s:%s", appConf.Host, appConf.Port)
 
 	engine = echo.New()
+	engine.IPExtractor = ipExtractor(appConf.TrustedProxies)
 
 	engine.Pre(middleware.RemoveTrailingSlash())
 	engine.Use(middleware.Logger())
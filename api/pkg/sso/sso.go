@@ -0,0 +1,144 @@
+package sso
+
+import (
+	"api/pkg/config"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrInvalidLogin returned when the provider rejects the code or the id token is not valid
+var ErrInvalidLogin = errors.New("invalid single sign-on login")
+
+const timeout = 10 * time.Second
+
+// Identity staff user authenticated by an OpenID Connect provider
+type Identity struct {
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// Provider OpenID Connect provider. Discovery runs on first use and is kept after success,
+// so the panel starts when the provider is unreachable.
+type Provider struct {
+	cfg    *config.OIDCProvider
+	client *http.Client
+	mu     sync.Mutex
+	oidc   *oidc.Provider
+}
+
+// New create an OpenID Connect provider of config
+func New(cfg *config.OIDCProvider) *Provider {
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: timeout}}
+}
+
+// Name provider name used in login urls
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// Config provider config
+func (p *Provider) Config() *config.OIDCProvider {
+	return p.cfg
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Provider, *oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oidc == nil {
+		provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovery of provider %s failed: %w", p.cfg.Name, err)
+		}
+		p.oidc = provider
+	}
+	return p.oidc, &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     p.oidc.Endpoint(),
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       append([]string{oidc.ScopeOpenID}, p.cfg.Scopes...),
+	}, nil
+}
+
+// AuthURL return the authorization url with state, nonce and the S256 challenge of verifier
+func (p *Provider) AuthURL(ctx context.Context, state, verifier, nonce string) (string, error) {
+	_, oauth, err := p.discover(oidc.ClientContext(ctx, p.client))
+	if err != nil {
+		return "", err
+	}
+	return oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)), nil
+}
+
+// Exchange exchange the authorization code with the PKCE verifier, then verify signature, issuer,
+// audience, expiry and nonce of the id token against the provider keys
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	ctx = oidc.ClientContext(ctx, p.client)
+	provider, oauth, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			return nil, ErrInvalidLogin
+		}
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrInvalidLogin
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLogin, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrInvalidLogin
+	}
+
+	var claims map[string]interface{}
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	identity := &Identity{
+		Subject:  idToken.Subject,
+		Username: stringClaim(claims, p.cfg.UsernameClaim),
+		Email:    stringClaim(claims, "email"),
+		Groups:   listClaim(claims, p.cfg.GroupsClaim),
+	}
+	if identity.Username == "" {
+		return nil, fmt.Errorf("claim %s of the username is missing", p.cfg.UsernameClaim)
+	}
+	return identity, nil
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// listClaim read a claim that is a list of strings or a single string
+func listClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var result []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package sso
+
+import (
+	"api/pkg/config"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// mockIdP local OpenID Connect provider with discovery, JWKS and a token endpoint that checks PKCE
+type mockIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	idp := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idp.sign(t),
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (m *mockIdP) sign(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(m.claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, sum[:])
+	assert.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockIdP) provider() *Provider {
+	return New(&config.OIDCProvider{
+		Name:          "mock",
+		Issuer:        m.server.URL,
+		ClientID:      "panel",
+		RedirectURL:   "https://panel.example.org/sso/mock",
+		Scopes:        []string{"profile"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+	})
+}
+
+func (m *mockIdP) authorize(t *testing.T, provider *Provider, nonce string) {
+	authURL, err := provider.AuthURL(context.Background(), "state", "verifier-0123456789-0123456789-0123456789", nonce)
+	assert.NoError(t, err)
+	u, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	assert.Equal(t, "state", u.Query().Get("state"))
+	assert.Equal(t, "openid profile", u.Query().Get("scope"))
+	m.challenge = u.Query().Get("code_challenge")
+}
+
+func (m *mockIdP) setClaims(audience, nonce string) {
+	m.claims = map[string]interface{}{
+		"iss":                m.server.URL,
+		"sub":                "0d1e2f",
+		"aud":                audience,
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"preferred_username": "alice",
+		"email":              "alice@example.org",
+		"groups":             []string{"vpn-admins", "helpdesk"},
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	idp.authorize(t, provider, "nonce")
+	idp.setClaims("panel", "nonce")
+
+	identity, err := provider.Exchange(context.Background(), "code", "verifier-0123456789-0123456789-0123456789", "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Subject:  "0d1e2f",
+		Username: "alice",
+		Email:    "alice@example.org",
+		Groups:   []string{"vpn-admins", "helpdesk"},
+	}, identity)
+}
+
+func TestExchangeRequiresVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	idp.authorize(t, provider, "nonce")
+	idp.setClaims("panel", "nonce")
+
+	_, err := provider.Exchange(context.Background(), "code", "another-verifier-0123456789-0123456789", "nonce")
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	idp.authorize(t, provider, "nonce")
+	verifier := "verifier-0123456789-0123456789-0123456789"
+
+	idp.setClaims("another-client", "nonce")
+	_, err := provider.Exchange(context.Background(), "code", verifier, "nonce")
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+
+	idp.setClaims("panel", "replayed")
+	_, err = provider.Exchange(context.Background(), "code", verifier, "nonce")
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+
+	idp.setClaims("panel", "nonce")
+	idp.claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = provider.Exchange(context.Background(), "code", verifier, "nonce")
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+}
+
+func TestExchangeRejectsForeignKey(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	idp.authorize(t, provider, "nonce")
+	idp.setClaims("panel", "nonce")
+
+	foreign, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	idp.key = foreign
+	_, err = provider.Exchange(context.Background(), "code", "verifier-0123456789-0123456789-0123456789", "nonce")
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+}
@@ -0,0 +1,171 @@
+package tokencache
+
+import (
+	"container/list"
+	"github.com/mmtaee/go-oc-utils/models"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSize = 10000
+	defaultTTL  = 30 * time.Second
+)
+
+type actionsEntry struct {
+	actions  []string
+	cachedAt time.Time
+}
+
+type entry struct {
+	token     *models.UserToken
+	cachedAt  time.Time
+	touchedAt time.Time
+}
+
+// Cache bounded in-process cache of resolved login tokens with a least recently used eviction,
+// and of the role actions of their users. Entries live at most ttl and tokens never after their
+// expire time. The cache is local to the process, so changes that revoke tokens, permissions or
+// roles must call Invalidate after commit.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	items   map[string]*list.Element
+	users   map[uint]map[string]struct{}
+	actions map[uint]actionsEntry
+	order   *list.List
+	nowFunc func() time.Time
+}
+
+var defaultCache = New(defaultSize, defaultTTL)
+
+// Default return the shared cache of the authentication middleware
+func Default() *Cache {
+	return defaultCache
+}
+
+// New create a cache of up to size tokens kept for ttl
+func New(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		items:   make(map[string]*list.Element),
+		users:   make(map[uint]map[string]struct{}),
+		actions: make(map[uint]actionsEntry),
+		order:   list.New(),
+		nowFunc: time.Now,
+	}
+}
+
+// Get return a cached token that is neither stale nor expired
+func (c *Cache) Get(token string) (*models.UserToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[token]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	now := c.nowFunc()
+	if now.Sub(e.cachedAt) >= c.ttl || (e.token.ExpireAt != nil && !e.token.ExpireAt.After(now)) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return e.token, true
+}
+
+// Set cache a resolved token, the least recently used token is evicted when the cache is full
+func (c *Cache) Set(token *models.UserToken) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[token.Token]; ok {
+		c.remove(elem)
+	}
+	for c.order.Len() >= c.size {
+		c.remove(c.order.Back())
+	}
+	c.items[token.Token] = c.order.PushFront(&entry{token: token, cachedAt: c.nowFunc()})
+	if c.users[token.UserID] == nil {
+		c.users[token.UserID] = make(map[string]struct{})
+	}
+	c.users[token.UserID][token.Token] = struct{}{}
+}
+
+// TouchDue report whether the last use of a cached token should be saved and mark it as saved.
+// Tokens that are not cached are always due.
+func (c *Cache) TouchDue(token string, interval time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[token]
+	if !ok {
+		return true
+	}
+	e := elem.Value.(*entry)
+	now := c.nowFunc()
+	if !e.touchedAt.IsZero() && now.Sub(e.touchedAt) < interval {
+		return false
+	}
+	e.touchedAt = now
+	return true
+}
+
+// Actions return cached role actions of a user that are not stale
+func (c *Cache) Actions(userID uint) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.actions[userID]
+	if !ok {
+		return nil, false
+	}
+	if c.nowFunc().Sub(e.cachedAt) >= c.ttl {
+		delete(c.actions, userID)
+		return nil, false
+	}
+	return e.actions, true
+}
+
+// SetActions cache role actions of a user. Actions are kept only while the user has cached tokens.
+func (c *Cache) SetActions(userID uint, actions []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.users[userID]) == 0 {
+		return
+	}
+	c.actions[userID] = actionsEntry{actions: actions, cachedAt: c.nowFunc()}
+}
+
+// Invalidate remove all cached tokens and role actions of users
+func (c *Cache) Invalidate(userIDs ...uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, userID := range userIDs {
+		for token := range c.users[userID] {
+			c.remove(c.items[token])
+		}
+		delete(c.actions, userID)
+	}
+}
+
+// Len number of cached tokens
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := c.order.Remove(elem).(*entry)
+	delete(c.items, e.token.Token)
+	if tokens := c.users[e.token.UserID]; tokens != nil {
+		delete(tokens, e.token.Token)
+		if len(tokens) == 0 {
+			delete(c.users, e.token.UserID)
+			delete(c.actions, e.token.UserID)
+		}
+	}
+}
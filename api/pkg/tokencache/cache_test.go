@@ -0,0 +1,112 @@
+package tokencache
+
+import (
+	"github.com/mmtaee/go-oc-utils/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newToken(userID uint, token string, expireAt time.Time) *models.UserToken {
+	return &models.UserToken{UserID: userID, Token: token, ExpireAt: &expireAt}
+}
+
+func newTestCache(size int, ttl time.Duration) (*Cache, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := New(size, ttl)
+	cache.nowFunc = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestCacheTTL(t *testing.T) {
+	cache, now := newTestCache(10, time.Minute)
+	cache.Set(newToken(1, "a", now.Add(time.Hour)))
+
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	*now = now.Add(time.Minute)
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCacheHonorsTokenExpiry(t *testing.T) {
+	cache, now := newTestCache(10, time.Hour)
+	cache.Set(newToken(1, "a", now.Add(time.Second)))
+
+	*now = now.Add(time.Second)
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, now := newTestCache(2, time.Hour)
+	cache.Set(newToken(1, "a", now.Add(time.Hour)))
+	cache.Set(newToken(1, "b", now.Add(time.Hour)))
+	_, _ = cache.Get("a")
+	cache.Set(newToken(2, "c", now.Add(time.Hour)))
+
+	_, ok := cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache, now := newTestCache(10, time.Hour)
+	cache.Set(newToken(1, "a", now.Add(time.Hour)))
+	cache.Set(newToken(1, "b", now.Add(time.Hour)))
+	cache.Set(newToken(2, "c", now.Add(time.Hour)))
+
+	cache.Invalidate(1)
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+}
+
+func TestCacheTouchDue(t *testing.T) {
+	cache, now := newTestCache(10, time.Hour)
+	assert.True(t, cache.TouchDue("a", time.Minute))
+
+	cache.Set(newToken(1, "a", now.Add(time.Hour)))
+	assert.True(t, cache.TouchDue("a", time.Minute))
+	assert.False(t, cache.TouchDue("a", time.Minute))
+
+	*now = now.Add(time.Minute)
+	assert.True(t, cache.TouchDue("a", time.Minute))
+}
+
+func TestCacheActions(t *testing.T) {
+	cache, now := newTestCache(1, time.Minute)
+	cache.SetActions(1, []string{"oc_user.read"})
+	_, ok := cache.Actions(1)
+	assert.False(t, ok, "actions are not cached without a cached token")
+
+	cache.Set(newToken(1, "a", now.Add(time.Hour)))
+	cache.SetActions(1, []string{"oc_user.read"})
+	actions, ok := cache.Actions(1)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"oc_user.read"}, actions)
+
+	cache.Invalidate(1)
+	_, ok = cache.Actions(1)
+	assert.False(t, ok)
+
+	cache.Set(newToken(1, "a", now.Add(time.Hour)))
+	cache.SetActions(1, []string{"oc_user.read"})
+	cache.Set(newToken(2, "b", now.Add(time.Hour)))
+	_, ok = cache.Actions(1)
+	assert.False(t, ok, "actions are evicted with the last token of the user")
+
+	cache.SetActions(2, nil)
+	*now = now.Add(time.Minute)
+	_, ok = cache.Actions(2)
+	assert.False(t, ok)
+}
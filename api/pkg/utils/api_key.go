@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// ApiKeyPrefix marks api keys in the Authorization header so they are not looked up as login tokens
+const ApiKeyPrefix = "ock_"
+
+// NewApiKey create a random api key and the short prefix shown to identify it
+func NewApiKey() (key, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = ApiKeyPrefix + hex.EncodeToString(b)
+	return key, key[:len(ApiKeyPrefix)+8], nil
+}
+
+// HashApiKey hash of api key to store and look up. Keys are random, so a fast hash is enough.
+func HashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// IsApiKey report whether the credential is an api key
+func IsApiKey(credential string) bool {
+	return strings.HasPrefix(credential, ApiKeyPrefix)
+}
+
+// IPAllowed report whether ip matches one of the comma separated ips or cidrs. Empty list allows all.
+func IPAllowed(allowed, ip string) bool {
+	if strings.TrimSpace(allowed) == "" {
+		return true
+	}
+	clientIP := net.ParseIP(ip)
+	if clientIP == nil {
+		return false
+	}
+	for _, item := range strings.Split(allowed, ",") {
+		item = strings.TrimSpace(item)
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			if network.Contains(clientIP) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(item); allowedIP != nil && allowedIP.Equal(clientIP) {
+			return true
+		}
+	}
+	return false
+}
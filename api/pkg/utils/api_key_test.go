@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewApiKey(t *testing.T) {
+	key, prefix, err := NewApiKey()
+	assert.NoError(t, err)
+	assert.True(t, IsApiKey(key))
+	assert.True(t, len(key) > len(prefix))
+	assert.Equal(t, key[:len(prefix)], prefix)
+	assert.Len(t, HashApiKey(key), 64)
+	assert.NotEqual(t, key, HashApiKey(key))
+
+	other, _, err := NewApiKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestIPAllowed(t *testing.T) {
+	assert.True(t, IPAllowed("", "10.0.0.1"))
+	assert.True(t, IPAllowed("10.0.0.0/24, 192.168.1.5", "10.0.0.9"))
+	assert.True(t, IPAllowed("10.0.0.0/24, 192.168.1.5", "192.168.1.5"))
+	assert.False(t, IPAllowed("10.0.0.0/24, 192.168.1.5", "192.168.1.6"))
+	assert.True(t, IPAllowed("2001:db8::/32", "2001:db8::1"))
+	assert.False(t, IPAllowed("10.0.0.0/24", "not-an-ip"))
+}
@@ -3,9 +3,23 @@ package utils
 import (
 	"api/pkg/config"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"math/rand"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+// argon2id parameters used for new password hashes
+const (
+	argon2Memory  uint32 = 64 * 1024
+	argon2Time    uint32 = 3
+	argon2Threads uint8  = 2
+	argon2KeyLen  uint32 = 32
+	argon2Prefix         = "$argon2id$"
 )
 
 type CustomPassword struct {
@@ -19,28 +33,70 @@ type CustomPasswordInterface interface {
 	Check(passwd, hashedPassword, salt string) bool
 }
 
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// NewPassword hash password with argon2id. The salt and parameters are encoded in Hash
+// in the form $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>, so Salt is always empty.
 func NewPassword(passwd string, saltLength ...int) *CustomPassword {
-	length := 6
+	length := 16
 	if len(saltLength) > 0 {
 		length = saltLength[0]
 	}
-	salt := createSalt(length)
+	salt := make([]byte, length)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	key := argon2.IDKey([]byte(passwd), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
 	return &CustomPassword{
-		Salt: salt,
-		Hash: create(passwd, salt),
+		Hash: fmt.Sprintf(
+			"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2Prefix,
+			argon2.Version,
+			argon2Memory,
+			argon2Time,
+			argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		),
 	}
 }
 
-func createSalt(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, length)
-	for i := range result {
-		result[i] = charset[rand.Intn(len(charset))]
+func decodeArgon2(hashedPassword string) (*argon2Params, error) {
+	var (
+		version int
+		params  argon2Params
+		err     error
+	)
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errors.New("invalid argon2id hash")
+	}
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, err
+	}
+	if version != argon2.Version {
+		return nil, errors.New("incompatible argon2 version")
 	}
-	return string(result)
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, err
+	}
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	return &params, nil
 }
 
-func create(passwd, salt string) string {
+// legacyHash is the salted md5 hash used before argon2id. It is kept to check old passwords only.
+func legacyHash(passwd, salt string) string {
 	secretKey := config.GetApp().SecretKey
 	passwordHash := fmt.Sprintf("%s%s%s", salt, passwd, secretKey)
 	hash := md5.New()
@@ -48,10 +104,28 @@ func create(passwd, salt string) string {
 	return hex.EncodeToString(hash.Sum(nil))
 }
 
+// Check compare password with argon2id hash or legacy md5 hash and salt
 func Check(passwd, hashedPassword, salt string) bool {
-	hash := create(passwd, salt)
-	if hashedPassword == hash {
+	if !strings.HasPrefix(hashedPassword, argon2Prefix) {
+		hash := legacyHash(passwd, salt)
+		return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(hash)) == 1
+	}
+	params, err := decodeArgon2(hashedPassword)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(passwd), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(params.key, key) == 1
+}
+
+// NeedsRehash report hashes that are legacy md5 or use other argon2id parameters than current ones
+func NeedsRehash(hashedPassword string) bool {
+	params, err := decodeArgon2(hashedPassword)
+	if err != nil {
 		return true
 	}
-	return false
+	return params.memory != argon2Memory ||
+		params.time != argon2Time ||
+		params.threads != argon2Threads ||
+		uint32(len(params.key)) != argon2KeyLen
 }
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is always denied in addition to the denylist of the panel settings
+var commonPasswords = []string{
+	"123456", "12345678", "123456789", "1234567890", "12345", "1234", "111111", "000000",
+	"123123", "654321", "666666", "121212", "112233", "123321", "987654321", "1q2w3e4r",
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "qwerty", "qwerty123",
+	"qwertyuiop", "asdfghjkl", "zxcvbnm", "1qaz2wsx", "abc123", "abcd1234", "iloveyou",
+	"admin", "admin123", "administrator", "root", "toor", "letmein", "welcome", "welcome1",
+	"monkey", "dragon", "master", "sunshine", "princess", "football", "baseball", "shadow",
+	"superman", "trustno1", "changeme", "secret", "test", "test123", "guest", "ocserv",
+	"openconnect", "vpn", "vpn123",
+}
+
+// PasswordPolicy strength rules of staff and ocserv user passwords
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	Denylist      []string
+	History       int
+}
+
+// ParseDenylist split a denylist separated by new lines or commas
+func ParseDenylist(denylist string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(denylist, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ','
+	}) {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func (p *PasswordPolicy) denied(password string) bool {
+	for _, list := range [][]string{commonPasswords, p.Denylist} {
+		for _, word := range list {
+			if strings.EqualFold(password, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check return the policy violations of password as field errors
+func (p *PasswordPolicy) Check(field, password string) []string {
+	var (
+		errs                        []string
+		upper, lower, digit, symbol bool
+	)
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if len([]rune(password)) < p.MinLength {
+		errs = append(errs, fmt.Sprintf("%s must be at least %d characters long", field, p.MinLength))
+	}
+	if p.RequireUpper && !upper {
+		errs = append(errs, field+" must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		errs = append(errs, field+" must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		errs = append(errs, field+" must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		errs = append(errs, field+" must contain a symbol")
+	}
+	if p.denied(password) {
+		errs = append(errs, field+" is too common")
+	}
+	return errs
+}
+
+// generatedPasswordLength length of generated passwords unless the policy requires longer ones
+const generatedPasswordLength = 12
+
+var passwordClasses = []string{
+	"ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"abcdefghijkmnopqrstuvwxyz",
+	"23456789",
+	"!@#%+=_-",
+}
+
+// GeneratePassword create a random password with a character of every class, so it satisfies
+// any policy that does not deny it
+func GeneratePassword(policy *PasswordPolicy) (string, error) {
+	length := generatedPasswordLength
+	if policy != nil && policy.MinLength > length {
+		length = policy.MinLength
+	}
+	all := strings.Join(passwordClasses, "")
+	password := make([]byte, length)
+	for i := range password {
+		chars := all
+		if i < len(passwordClasses) {
+			chars = passwordClasses[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = chars[n.Int64()]
+	}
+	// move the characters of every class to random positions
+	for i := len(password) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
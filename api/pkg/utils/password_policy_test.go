@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:     8,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		Denylist:      ParseDenylist("Company2024!\nacme, vpnpass"),
+	}
+	assert.Empty(t, policy.Check("password", "S3cure-Pass"))
+	assert.Equal(t, []string{
+		"password must be at least 8 characters long",
+		"password must contain an uppercase letter",
+		"password must contain a digit",
+		"password must contain a symbol",
+	}, policy.Check("password", "short"))
+	assert.Equal(t, []string{"password must contain a lowercase letter", "password is too common"}, policy.Check("password", "COMPANY2024!"))
+	assert.Contains(t, policy.Check("password", "P@ssw0rd"), "password is too common")
+}
+
+func TestPasswordPolicyDefaults(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 1}
+	assert.Empty(t, policy.Check("password", "x"))
+	assert.Equal(t, []string{"password is too common"}, policy.Check("password", "qwerty"))
+}
+
+func TestParseDenylist(t *testing.T) {
+	assert.Equal(t, []string{"a", "b c", "d"}, ParseDenylist(" a\r\nb c,,d\n"))
+	assert.Empty(t, ParseDenylist(""))
+}
+
+func TestValidatePassword(t *testing.T) {
+	v := NewCustomValidator()
+	assert.Nil(t, v.ValidatePassword("password", "anything", nil))
+	err := v.ValidatePassword("new_password", "abc", &PasswordPolicy{MinLength: 6})
+	assert.Equal(t, map[string]interface{}{
+		"error": []string{"new_password must be at least 6 characters long"},
+	}, err)
+}
+
+func TestGeneratePassword(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 14, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	passwd, err := GeneratePassword(policy)
+	assert.NoError(t, err)
+	assert.Len(t, passwd, 14)
+	assert.Empty(t, policy.Check("password", passwd))
+
+	passwd, err = GeneratePassword(nil)
+	assert.NoError(t, err)
+	assert.Len(t, passwd, generatedPasswordLength)
+}
@@ -2,18 +2,39 @@ package utils
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
 func TestCreatePassword(t *testing.T) {
 	hashPassword := NewPassword("random-password")
 	assert.NotNil(t, hashPassword)
+	assert.True(t, strings.HasPrefix(hashPassword.Hash, "$argon2id$v=19$m=65536,t=3,p=2$"))
+	assert.Empty(t, hashPassword.Salt)
 }
 
 func TestCheck(t *testing.T) {
 	pass := NewPassword("random-password")
 	ok := Check("random-password", pass.Hash, pass.Salt)
 	assert.True(t, ok)
+	assert.False(t, Check("wrong-password", pass.Hash, pass.Salt))
+}
+
+func TestCheckLegacy(t *testing.T) {
+	hash := legacyHash("random-password", "abc123")
+	assert.True(t, Check("random-password", hash, "abc123"))
+	assert.False(t, Check("wrong-password", hash, "abc123"))
+	assert.False(t, Check("random-password", hash, "other"))
+}
+
+func TestCheckInvalidHash(t *testing.T) {
+	assert.False(t, Check("random-password", "$argon2id$v=19$m=65536$broken", ""))
+}
+
+func TestNeedsRehash(t *testing.T) {
+	assert.False(t, NeedsRehash(NewPassword("random-password").Hash))
+	assert.True(t, NeedsRehash(legacyHash("random-password", "abc123")))
+	assert.True(t, NeedsRehash("$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"))
 }
 
 func BenchmarkCreatePassword(b *testing.B) {
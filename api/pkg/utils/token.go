@@ -2,10 +2,13 @@ package utils
 
 import (
 	"api/pkg/config"
+	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
-
+	"strings"
 	"time"
 )
 
@@ -18,3 +21,53 @@ func Create(userID uint, expire time.Time) string {
 	hashHex := hex.EncodeToString(hash)
 	return hashHex
 }
+
+// Challenge is the state carried by a login challenge token between password and second factor steps
+type Challenge struct {
+	UserID     uint
+	RememberMe bool
+	ExpireAt   time.Time
+}
+
+func signChallenge(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.GetApp().SecretKey))
+	mac.Write([]byte("challenge:" + payload))
+	return mac.Sum(nil)
+}
+
+// CreateChallenge create a signed short-lived login challenge token
+func CreateChallenge(userID uint, rememberMe bool, expire time.Time) string {
+	payload := fmt.Sprintf("%d:%t:%d", userID, rememberMe, expire.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(signChallenge(payload))
+}
+
+// ParseChallenge verify signature and expiry of login challenge token
+func ParseChallenge(token string) (*Challenge, error) {
+	var (
+		challenge Challenge
+		expire    int64
+	)
+	invalid := errors.New("invalid or expired challenge")
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, invalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signChallenge(string(payload))) {
+		return nil, invalid
+	}
+	_, err = fmt.Sscanf(strings.ReplaceAll(string(payload), ":", " "), "%d %t %d", &challenge.UserID, &challenge.RememberMe, &expire)
+	if err != nil {
+		return nil, invalid
+	}
+	challenge.ExpireAt = time.Unix(expire, 0)
+	if time.Now().After(challenge.ExpireAt) {
+		return nil, invalid
+	}
+	return &challenge, nil
+}
@@ -11,6 +11,20 @@ func TestGenerateToken(t *testing.T) {
 	assert.NotEmpty(t, token1)
 }
 
+func TestChallenge(t *testing.T) {
+	token := CreateChallenge(7, true, time.Now().Add(time.Minute))
+	challenge, err := ParseChallenge(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), challenge.UserID)
+	assert.True(t, challenge.RememberMe)
+
+	_, err = ParseChallenge(token + "x")
+	assert.Error(t, err)
+
+	_, err = ParseChallenge(CreateChallenge(7, false, time.Now().Add(-time.Second)))
+	assert.Error(t, err)
+}
+
 func BenchmarkGenerateToken(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		Create(uint(i), time.Now().Add(24*time.Hour))
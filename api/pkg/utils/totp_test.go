@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1111111111: "14050471",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+	for unix, code := range vectors {
+		assert.Equal(t, code, hotp(key, uint64(unix/totpPeriod), 8))
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	code, err := TOTPCode(secret, now.Add(-totpPeriod*time.Second))
+	assert.NoError(t, err)
+	step, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, TOTPStep(now)-1, step)
+
+	code, err = TOTPCode(secret, now.Add(-3*totpPeriod*time.Second))
+	assert.NoError(t, err)
+	_, ok = ValidateTOTP(secret, code, now)
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "12", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Ocserv Panel", "john_doe", "SECRET")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Ocserv%20Panel:john_doe?"))
+	assert.Contains(t, uri, "secret=SECRET")
+}
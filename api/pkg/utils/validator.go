@@ -15,6 +15,7 @@ type CustomValidator struct {
 
 type CustomValidatorInterface interface {
 	Validate(echo.Context, interface{}) interface{}
+	ValidatePassword(field, password string, policy *PasswordPolicy) interface{}
 }
 
 func NewCustomValidator() *CustomValidator {
@@ -90,3 +91,17 @@ func (v *CustomValidator) Validate(c echo.Context, data interface{}) interface{}
 	}
 	return nil
 }
+
+// ValidatePassword check password against the password policy and return field errors
+// in the same format as Validate
+func (v *CustomValidator) ValidatePassword(field, password string, policy *PasswordPolicy) interface{} {
+	if policy == nil {
+		return nil
+	}
+	if errs := policy.Check(field, password); len(errs) > 0 {
+		return map[string]interface{}{
+			"error": errs,
+		}
+	}
+	return nil
+}